@@ -4,7 +4,11 @@ import (
 	//"time"
 	"encoding/json"
 	"fmt"
-	"math"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 
 	//"strings"
 	//"bytes"
@@ -21,18 +25,43 @@ import (
 /* -------------------------------------------------------------------------------------------------
 Init:  this function is called at PRIVI Blockchain Deployment and initialises the Coin Balance
 	   Smart Contract. This smart contract is the responsible to manage the balances of the
-	   different tokens powered in PRIVI Ecosystem. The initialisation sets the Private Key ID
-	   of the admin in the ledger. Args: array containing a string:
+	   different tokens powered in PRIVI Ecosystem. The initialisation seeds the access rules
+	   of the functions that have no rule yet, also on upgrades, and sets the governance when
+	   it is given and none is stored yet. A stored governance is only changed by an
+	   updateGovernance proposal. Args: array containing the strings:
 PrivateKeyID           string   // Private Key of the admin of the smart contract
+Governance             string   // Optional json with the Approvers, Threshold and ProposalLifetime
 ------------------------------------------------------------------------------------------------- */
 
 func (t *CoinBalanceSmartContract) Init(stub shim.ChaincodeStubInterface) pb.Response {
 
+	err := seedAccessRules(stub)
+	if err != nil {
+		return shim.Error("ERROR: SEEDING THE ACCESS RULES. " + err.Error())
+	}
+
 	_, args := stub.GetFunctionAndParameters()
-	if args[0] == "UPGRADE" {
+	if len(args) < 2 || args[1] == "" {
 		return shim.Success(nil)
 	}
 
+	// Set the initial governance, kept on upgrades //
+	_, isSet, err := getGovernance(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if isSet {
+		return shim.Success(nil)
+	}
+	governance := Governance{}
+	err = json.Unmarshal([]byte(args[1]), &governance)
+	if err != nil {
+		return shim.Error("ERROR: GETTING THE GOVERNANCE. " + err.Error())
+	}
+	err = saveGovernance(stub, governance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	return shim.Success(nil)
 }
 
@@ -46,24 +75,38 @@ func (t *CoinBalanceSmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.R
 	// Retrieve function and arguments //
 	function, args := stub.GetFunctionAndParameters()
 
+	// Check the caller against the access rule of the function //
+	err := checkAccess(stub, function)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkNotGoverned(stub, function)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Call the proper function //
 	switch function {
 
 	case "registerToken":
-		err := checkPermissions(stub, ADMIN_ROLE, function)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		return t.registerToken(stub, args)
+		return t.registerToken(stub, args, false)
 
 	case "removeToken":
-		err := checkPermissions(stub, ADMIN_ROLE, function)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
 		return t.removeToken(stub, args)
 
+	case "setTokenStatus":
+		return t.setTokenStatus(stub, args)
+
+	case "redeemToken":
+		return t.redeemToken(stub, args)
+
+	case "reuseTokenSymbol":
+		return t.registerToken(stub, args, true)
+
 	case "getTokenInfoByType":
+		if err := checkArgs(args, 1, "getTokenInfoByType"); err != nil {
+			return shim.Error(err.Error())
+		}
 		tokenList, err := t.getTokenInfoByType(stub, args[0])
 		if err != nil {
 			return shim.Error(err.Error())
@@ -72,6 +115,9 @@ func (t *CoinBalanceSmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.R
 		return shim.Success(tokenListBytes)
 
 	case "getTokenListByType":
+		if err := checkArgs(args, 1, "getTokenListByType"); err != nil {
+			return shim.Error(err.Error())
+		}
 		tokenList, err := t.getTokenListByType(stub, args[0])
 		if err != nil {
 			return shim.Error(err.Error())
@@ -80,6 +126,9 @@ func (t *CoinBalanceSmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.R
 		return shim.Success(tokenListBytes)
 
 	case "getToken":
+		if err := checkArgs(args, 1, "getToken"); err != nil {
+			return shim.Error(err.Error())
+		}
 		token, err := t.getToken(stub, args[0])
 		if err != nil {
 			return shim.Error(err.Error())
@@ -87,7 +136,47 @@ func (t *CoinBalanceSmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.R
 		tokenBytes, _ := json.Marshal(token)
 		return shim.Success(tokenBytes)
 
+	case "getArchivedTokens":
+		if err := checkArgs(args, 1, "getArchivedTokens"); err != nil {
+			return shim.Error(err.Error())
+		}
+		tokens, err := getArchivedTokens(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		tokensBytes, _ := json.Marshal(tokens)
+		return shim.Success(tokensBytes)
+
+	case "registerAddress":
+		return t.registerAddress(stub, args)
+
+	case "unregisterAddress":
+		return t.unregisterAddress(stub, args)
+
+	case "confirmPrimaryAddress":
+		return t.confirmPrimaryAddress(stub, args)
+
+	case "approveAddress":
+		return t.approveAddress(stub, args)
+
+	case "getWallet":
+		if err := checkArgs(args, 1, "getWallet"); err != nil {
+			return shim.Error(err.Error())
+		}
+		wallet, isLoaded, err := getWallet(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !isLoaded {
+			return shim.Error("ERROR: ADDRESS DOES NOT EXISTS")
+		}
+		walletBytes, _ := json.Marshal(wallet)
+		return shim.Success(walletBytes)
+
 	case "checkAddressExist":
+		if err := checkArgs(args, 1, "checkAddressExist"); err != nil {
+			return shim.Error(err.Error())
+		}
 		exist := t.checkAddressExist(stub, args[0])
 		if !exist {
 			return shim.Error("ERROR: ADDRESS DOES NOT EXISTS")
@@ -101,11 +190,10 @@ func (t *CoinBalanceSmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.R
 		return t.balanceOf(stub, args)
 
 	case "mint":
-		err := checkPermissions(stub, ADMIN_ROLE, function)
-		if err != nil {
-			return shim.Error(err.Error())
-		}
-		return t.mint(stub, args)
+		return t.mint(stub, args, false)
+
+	case "multiMint":
+		return t.multiMint(stub, args)
 
 	case "burn":
 		return t.burn(stub, args)
@@ -116,6 +204,104 @@ func (t *CoinBalanceSmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.R
 	case "multitransfer":
 		return t.multitransfer(stub, args)
 
+	case "approve":
+		return t.changeAllowance(stub, args, APPROVE_TYPE)
+
+	case "increaseAllowance":
+		return t.changeAllowance(stub, args, INCREASE_ALLOWANCE_TYPE)
+
+	case "decreaseAllowance":
+		return t.changeAllowance(stub, args, DECREASE_ALLOWANCE_TYPE)
+
+	case "allowance":
+		return t.allowance(stub, args)
+
+	case "transferFrom":
+		return t.transferFrom(stub, args)
+
+	case "grantCredit":
+		return t.grantCredit(stub, args)
+
+	case "getCreditLine":
+		return t.getCreditLine(stub, args)
+
+	case "setCreditPool":
+		return t.setCreditPool(stub, args)
+
+	case "getCreditPool":
+		if err := checkArgs(args, 1, "getCreditPool"); err != nil {
+			return shim.Error(err.Error())
+		}
+		pool, err := getCreditPool(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		poolBytes, _ := json.Marshal(pool)
+		return shim.Success(poolBytes)
+
+	case "grantPoolCredit":
+		return t.grantPoolCredit(stub, args)
+
+	case "getPoolCredits":
+		return t.getPoolCredits(stub, args)
+
+	case "spendFunds":
+		return t.spendFunds(stub, args)
+
+	case "repayPoolCredit":
+		return t.repayPoolCredit(stub, args)
+
+	case "createAirdrop":
+		return t.createAirdrop(stub, args)
+
+	case "claim":
+		return t.claim(stub, args)
+
+	case "reclaimAirdrop":
+		return t.reclaimAirdrop(stub, args)
+
+	case "auditToken":
+		return t.auditToken(stub, args)
+
+	case "getTokenAudits":
+		if err := checkArgs(args, 1, "getTokenAudits"); err != nil {
+			return shim.Error(err.Error())
+		}
+		audits, err := getTokenAudits(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		auditsBytes, _ := json.Marshal(audits)
+		return shim.Success(auditsBytes)
+
+	case "getAirdrop":
+		if err := checkArgs(args, 1, "getAirdrop"); err != nil {
+			return shim.Error(err.Error())
+		}
+		airdrop, err := getAirdrop(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		airdropBytes, _ := json.Marshal(airdrop)
+		return shim.Success(airdropBytes)
+
+	case "revokeVesting":
+		return t.revokeVesting(stub, args)
+
+	case "getVestingSchedule":
+		return t.getVestingSchedule(stub, args)
+
+	case "updateConfig":
+		return t.updateConfig(stub, args)
+
+	case "getConfig":
+		config, err := getConfig(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		configBytes, _ := json.Marshal(config)
+		return shim.Success(configBytes)
+
 	case "initialiseBalance":
 		return t.initialiseBalance(stub, args)
 
@@ -134,7 +320,27 @@ func (t *CoinBalanceSmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.R
 	case "getBalancesOfTokenHolders":
 		return t.getBalancesOfTokenHolders(stub, args)
 
+	case "getNonce":
+		if err := checkArgs(args, 1, "getNonce"); err != nil {
+			return shim.Error(err.Error())
+		}
+		nonce, err := getNonce(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		nonceBytes, _ := json.Marshal(nonce)
+		return shim.Success(nonceBytes)
+
+	case "getHistory":
+		return t.getHistory(stub, args)
+
+	case "getTransaction":
+		return t.getTransaction(stub, args)
+
 	case "getTokenHolderList":
+		if err := checkArgs(args, 1, "getTokenHolderList"); err != nil {
+			return shim.Error(err.Error())
+		}
 		holderList, err := getTokenHolderList(stub, args[0])
 		if err != nil {
 			return shim.Error(err.Error())
@@ -142,12 +348,209 @@ func (t *CoinBalanceSmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.R
 		holderListBytes, _ := json.Marshal(holderList)
 		return shim.Success(holderListBytes)
 
+	case "getTokenHolderListPage":
+		return t.getTokenHoldersPage(stub, args, true)
+
+	case "getBalancesOfTokenHoldersPage":
+		return t.getTokenHoldersPage(stub, args, false)
+
+	case "getTokenListByTypePage":
+		return t.getTokensByTypePage(stub, args, true)
+
+	case "getTokenInfoByTypePage":
+		return t.getTokensByTypePage(stub, args, false)
+
+	case "migrateDocTypes":
+		return t.migrateDocTypes(stub, args)
+
 	case "updateTokenInfo":
-		err := checkPermissions(stub, ADMIN_ROLE, function)
+		return t.updateTokenInfo(stub, args)
+
+	case "propose":
+		return t.propose(stub, args)
+
+	case "approveProposal":
+		return t.approveProposal(stub, args)
+
+	case "executeProposal":
+		return t.executeProposal(stub, args)
+
+	case "getProposal":
+		if err := checkArgs(args, 1, "getProposal"); err != nil {
+			return shim.Error(err.Error())
+		}
+		proposal := Proposal{Id: args[0]}
+		isLoaded, err := proposal.LoadState(stub)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-		return t.updateTokenInfo(stub, args)
+		if !isLoaded {
+			return shim.Error("ERROR: THE PROPOSAL " + args[0] + " DOES NOT EXIST.")
+		}
+		proposalBytes, _ := json.Marshal(proposal)
+		return shim.Success(proposalBytes)
+
+	case "getGovernance":
+		governance, _, err := getGovernance(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		governanceBytes, _ := json.Marshal(governance)
+		return shim.Success(governanceBytes)
+
+	case "getIdentity":
+		identity, err := getIdentity(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success([]byte(identity))
+
+	case "setFeeSchedule":
+		return t.setFeeSchedule(stub, args)
+
+	case "getFeeSchedule":
+		if err := checkArgs(args, 1, "getFeeSchedule"); err != nil {
+			return shim.Error(err.Error())
+		}
+		schedule := FeeSchedule{Token: args[0]}
+		isLoaded, err := schedule.LoadState(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !isLoaded {
+			return shim.Error("ERROR: THE TOKEN " + args[0] + " HAS NO FEE SCHEDULE.")
+		}
+		scheduleBytes, _ := json.Marshal(schedule)
+		return shim.Success(scheduleBytes)
+
+	case "setMinterQuota":
+		return t.setMinterQuota(stub, args)
+
+	case "removeMinterQuota":
+		return t.removeMinterQuota(stub, args)
+
+	case "getMinterQuota":
+		if err := checkArgs(args, 2, "getMinterQuota"); err != nil {
+			return shim.Error(err.Error())
+		}
+		quota, isSet, err := getMinterQuota(stub, args[0], args[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !isSet {
+			return shim.Error("ERROR: THE MINTER " + args[0] + " HAS NO QUOTA FOR " +
+				args[1] + ".")
+		}
+		quotaBytes, _ := json.Marshal(quota)
+		return shim.Success(quotaBytes)
+
+	case "getMinterQuotas":
+		if err := checkArgs(args, 1, "getMinterQuotas"); err != nil {
+			return shim.Error(err.Error())
+		}
+		quotas, err := getMinterQuotas(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		quotasBytes, _ := json.Marshal(quotas)
+		return shim.Success(quotasBytes)
+
+	case "mintItem":
+		return t.mintItem(stub, args)
+
+	case "transferItem":
+		return t.transferItem(stub, args)
+
+	case "approveItem":
+		return t.approveItem(stub, args)
+
+	case "setItemOperator":
+		return t.setItemOperator(stub, args)
+
+	case "ownerOf":
+		if err := checkArgs(args, 2, "ownerOf"); err != nil {
+			return shim.Error(err.Error())
+		}
+		item, err := getItem(stub, args[0], args[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success([]byte(item.Owner))
+
+	case "getItem":
+		if err := checkArgs(args, 2, "getItem"); err != nil {
+			return shim.Error(err.Error())
+		}
+		item, err := getItem(stub, args[0], args[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		itemBytes, _ := json.Marshal(item)
+		return shim.Success(itemBytes)
+
+	case "getItemsOfOwner":
+		return t.getItemsOfOwner(stub, args)
+
+	case "isItemOperator":
+		if err := checkArgs(args, 3, "isItemOperator"); err != nil {
+			return shim.Error(err.Error())
+		}
+		isOperator, err := isItemOperator(stub, args[0], args[1], args[2])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		isOperatorBytes, _ := json.Marshal(isOperator)
+		return shim.Success(isOperatorBytes)
+
+	case "distributeDividend":
+		return t.distributeDividend(stub, args)
+
+	case "cancelDividend":
+		return t.cancelDividend(stub, args)
+
+	case "getDividend":
+		if err := checkArgs(args, 1, "getDividend"); err != nil {
+			return shim.Error(err.Error())
+		}
+		dividend := Dividend{Id: args[0]}
+		isLoaded, err := dividend.LoadState(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !isLoaded {
+			return shim.Error("ERROR: THE DIVIDEND " + args[0] + " DOES NOT EXIST.")
+		}
+		dividendBytes, _ := json.Marshal(dividend)
+		return shim.Success(dividendBytes)
+
+	case "setAccessRule":
+		return t.setAccessRule(stub, args)
+
+	case "removeAccessRule":
+		return t.removeAccessRule(stub, args)
+
+	case "getAccessRule":
+		if err := checkArgs(args, 1, "getAccessRule"); err != nil {
+			return shim.Error(err.Error())
+		}
+		rule := AccessRule{Function: args[0]}
+		isLoaded, err := rule.LoadState(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !isLoaded {
+			return shim.Error("ERROR: THE FUNCTION " + args[0] + " HAS NO ACCESS RULE.")
+		}
+		ruleBytes, _ := json.Marshal(rule)
+		return shim.Success(ruleBytes)
+
+	case "getAccessRules":
+		rules, err := getAccessRules(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		rulesBytes, _ := json.Marshal(rules)
+		return shim.Success(rulesBytes)
 
 	}
 
@@ -163,18 +566,23 @@ registerToken:  this function is called when a new token is listed on the PRIVI
 Name           string   // Name of the Token  (args[0])
 TokenType      string   // Type of Token to register
 TokenSymbol    string   // Symbol of the Token
-Supply         string   // Supply introduced at creation
+Decimals       int      // Number of decimals of the token (base units per token = 10^Decimals)
+Supply         string   // Supply introduced at creation in base units
+MaxSupply      string   // Optional maximum supply in base units (0 for no cap)
 LockUpDate     string   // If the token has a lock up date which prevent to be transfered
 Address        string   // Address to input initial supply (args[1])
+Vesting        string   // Optional vesting schedule json of the initial supply (args[2])
+The symbol of an archived token can only be registered again with the reuseSymbol override of an
+admin, the archived token is then kept under its registration TxID for audit.
 ------------------------------------------------------------------------------------------------- */
 
 func (t *CoinBalanceSmartContract) registerToken(stub shim.ChaincodeStubInterface,
-	args []string) pb.Response {
+	args []string, reuseSymbol bool) pb.Response {
 
 	// Retrieve arguments of the input in a Token Model struct //
-	if len(args) != 2 {
+	if len(args) != 2 && len(args) != 3 {
 		return shim.Error("ERROR: REGISTER TOKEN FUNCTION SHOULD BE CALLED " +
-			"WITH 2 ARGUMENTS.")
+			"WITH 2 OR 3 ARGUMENTS.")
 	}
 	token := Token{}
 	json.Unmarshal([]byte(args[0]), &token)
@@ -185,13 +593,37 @@ func (t *CoinBalanceSmartContract) registerToken(stub shim.ChaincodeStubInterfac
 		return shim.Error(err.Error())
 	}
 	if tokenCheck {
-		return shim.Error("ERROR: TOKEN " + token.Symbol + " ALREADY REGISTERED " +
-			"ON THE SYSTEM. ")
+		err = t.archiveTokenSymbol(stub, token.Symbol, reuseSymbol)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	token.Status = TOKEN_ACTIVE
+
+	// Check decimals and convert supply to base units //
+	if token.Decimals < 0 || token.Decimals > MAX_DECIMALS {
+		return shim.Error(fmt.Sprintf("ERROR: THE DECIMALS OF A TOKEN SHOULD BE "+
+			"BETWEEN 0 AND %d.", MAX_DECIMALS))
+	}
+	err = token.Supply.Resolve(token.Decimals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if token.Supply.Sign() < 0 {
+		return shim.Error("ERROR: THE SUPPLY OF A TOKEN CANNOT BE NEGATIVE.")
+	}
+	err = token.MaxSupply.Resolve(token.Decimals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkMaxSupply(token)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
 	// Check if integer condition if we have an NFT Pod Token //
 	if token.TokenType == NFT_POD_TOKEN {
-		if token.Supply != math.Trunc(token.Supply) {
+		if !token.Supply.IsWhole(token.Decimals) {
 			return shim.Error("ERROR: THE SUPPLY OF NFT POD TOKEN " +
 				" SHOULD BE AN INTEGER.")
 		}
@@ -208,64 +640,242 @@ func (t *CoinBalanceSmartContract) registerToken(stub shim.ChaincodeStubInterfac
 	// Update address with the initial supply //
 	balance := Balance{
 		Token: token.Symbol, Address: args[1],
-		Amount: token.Supply, Credit: 0.}
+		Amount: token.Supply, Credit: NewAmount(0)}
+	if len(args) == 3 {
+		schedule := VestingSchedule{}
+		err = json.Unmarshal([]byte(args[2]), &schedule)
+		if err != nil {
+			return shim.Error("ERROR: GETTING THE VESTING SCHEDULE. " + err.Error())
+		}
+		err = createVestingSchedule(stub, schedule, &balance, token.Supply)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
 	err = t.updateBalance(stub, balance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	balances := make(map[string]Balance)
 	balances[args[1]+" "+token.Symbol] = balance
 
-	return generateOutput(balances, tokens, nil)
+	return generateOutput(stub, EVENT_TOKEN_REGISTERED, balances, tokens, nil)
 
 }
 
 /* -------------------------------------------------------------------------------------------------
-removeToken:  this function is called when a pod Token is removed from the system.
+removeToken:  this function is called when a pod Token is removed from the system. The token must
+              be DELISTING without holders left (see redeemToken). It is archived and remains
+              queryable for audit.
 Symbol         string   // Symbol of the Token
 ------------------------------------------------------------------------------------------------- */
 
 func (t *CoinBalanceSmartContract) removeToken(stub shim.ChaincodeStubInterface,
 	args []string) pb.Response {
 
-	token, err := t.getToken(stub, args[0])
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	err = stub.PutState(IndexToken+token.Symbol, nil)
-	if err != nil {
-		return shim.Error("ERROR: DELETING TOKEN " + token.Symbol +
-			" ON BLOCKCHAIN. " + err.Error())
+	if len(args) != 1 {
+		return shim.Error("ERROR: REMOVETOKEN FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
 	}
-	return shim.Success(nil)
-
+	return t.setTokenStatus(stub, []string{args[0], TOKEN_ARCHIVED})
 }
 
 /* -------------------------------------------------------------------------------------------------
-balanceOf: This function is called to get the balance on the wallet of a given actor. The caller of
-		   this function can only be Cache Admin or wallet owner.
-		   Args: array containing
-args[0]               string   // Public Id Key of the actor
-args[1]               string   // Token Symbol
-
-// digestHash -> string
-// signature -> string
+setTokenStatus:  this function moves a token through its lifecycle. Active tokens can be paused or
+                 delisted, delisting tokens only allow burns and redemptions, and tokens can only
+                 be archived once no balance has funds or credit and nothing is escrowed. The
+                 states kept under the symbol are cleared when the token is archived.
+Symbol         string   // Symbol of the Token (args[0])
+Status         string   // ACTIVE, PAUSED, DELISTING or ARCHIVED (args[1])
 ------------------------------------------------------------------------------------------------- */
 
-func (t *CoinBalanceSmartContract) balanceOf(stub shim.ChaincodeStubInterface,
+func (t *CoinBalanceSmartContract) setTokenStatus(stub shim.ChaincodeStubInterface,
 	args []string) pb.Response {
 
-	// Retrieve information from the input //
 	if len(args) != 2 {
-		return shim.Error("ERROR: BALANCEOF FUNCTION SHOULD BE CALLED " +
-			"WITH TWO ARGUMENT.")
+		return shim.Error("ERROR: SETTOKENSTATUS FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
 	}
-
-	// Get balance //
-	balance, err := t.checkBalance(stub, args[0], args[1], true)
+	token, err := t.getToken(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	balanceBytes, _ := json.Marshal(balance)
-	return shim.Success(balanceBytes)
+
+	// Check transition of the lifecycle //
+	if !stringInSlice(args[1], TOKEN_STATUS_TRANSITIONS[token.Status]) {
+		return shim.Error("ERROR: TOKEN " + token.Symbol + " CANNOT CHANGE FROM " +
+			token.Status + " TO " + args[1] + ".")
+	}
+
+	// Check that no holder, credit or escrow is left before archiving //
+	eventName := EVENT_TOKEN_STATUS_CHANGED
+	if args[1] == TOKEN_ARCHIVED {
+		addressList, err := getTokenIndexKeys(stub, IndexTokenBalances, token.Symbol, 0)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if len(addressList) > 0 {
+			return shim.Error(fmt.Sprintf("ERROR: TOKEN %s STILL HAS %d HOLDERS OR "+
+				"DEBTORS. THEY SHOULD BE REDEEMED BEFORE ARCHIVING IT.", token.Symbol,
+				len(addressList)))
+		}
+		escrowed, err := getEscrowedAmount(stub, token.Symbol)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if escrowed.Sign() > 0 {
+			return shim.Error("ERROR: TOKEN " + token.Symbol + " STILL HAS " +
+				escrowed.String() + " ESCROWED BY AIRDROPS OR DIVIDENDS.")
+		}
+
+		// Clear the states kept under the symbol of the token //
+		err = clearTokenStates(stub, token.Symbol)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		eventName = EVENT_TOKEN_REMOVED
+	}
+
+	token.Status = args[1]
+	err = t.updateToken(stub, token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	tokens := make(map[string]Token)
+	tokens[token.Symbol] = token
+
+	return generateOutput(stub, eventName, nil, tokens, nil)
+}
+
+/* -------------------------------------------------------------------------------------------------
+redeemToken:  this function is called by an admin to force the redemption of the holders of a
+              delisting token. The balances of up to MAX_PAGE_SIZE holders are burned and a
+              Redemption transaction is recorded for each one, so that they can be paid off chain.
+              The credit outstanding on the balances is written off and the vesting schedules,
+              credit lines, allowances and operators of the holders are removed. Open airdrops
+              should be reclaimed first. It should be called until no holder is left.
+Symbol         string   // Symbol of the Token (args[0])
+Id             string   // Id of the redemption, suffixed by the address of each holder (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) redeemToken(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	if len(args) != 2 {
+		return shim.Error("ERROR: REDEEMTOKEN FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+	err := checkTransactionId(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	token, err := t.getToken(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkTokenStatus(token, TOKEN_DELISTING)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Check that the escrowed funds were returned to balances before redeeming them //
+	escrowed, err := getEscrowedAmount(stub, token.Symbol)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if escrowed.Sign() > 0 {
+		return shim.Error("ERROR: TOKEN " + token.Symbol + " STILL HAS " + escrowed.String() +
+			" ESCROWED BY AIRDROPS OR DIVIDENDS. THEY SHOULD BE RECLAIMED BEFORE " +
+			"REDEEMING THE HOLDERS.")
+	}
+
+	// Burn balances and write off credit of a batch of holders //
+	addressList, err := getTokenIndexKeys(stub, IndexTokenBalances, token.Symbol, MAX_PAGE_SIZE)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	balances, err := loadHolderBalances(stub, token.Symbol, addressList)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	updateBalances := make(map[string]Balance)
+	transactions := make(map[string]Transfer)
+	for _, balance := range balances {
+		token.Supply, err = saveSubstraction(token.Supply.Add(balance.Credit), balance.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if balance.Amount.Sign() > 0 {
+			redemption := Transfer{
+				Type: "Redemption", Token: token.Symbol, From: balance.Address,
+				Amount: balance.Amount, Id: transactionLegId(args[1], balance.Address),
+				Date: timestamp}
+			err = checkTransactionLegNotProcessed(stub, redemption.Id)
+			if err != nil {
+				return errorResponse(err)
+			}
+			err = recordTransaction(stub, redemption)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			transactions[redemption.Id] = redemption
+		}
+		balance.Amount = NewAmount(0)
+		balance.Credit = NewAmount(0)
+		balance.LockUpDate = 0
+		balance.Items = 0
+		err = t.updateBalance(stub, balance)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = clearHolderStates(stub, balance.Address, token.Symbol)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		updateBalances[balance.Address+" "+token.Symbol] = balance
+	}
+
+	err = t.updateToken(stub, token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	tokens := make(map[string]Token)
+	tokens[token.Symbol] = token
+
+	return generateOutput(stub, EVENT_TOKEN_REDEEMED, updateBalances, tokens, transactions)
+}
+
+/* -------------------------------------------------------------------------------------------------
+balanceOf: This function is called to get the balance on the wallet of a given actor. The caller of
+		   this function can only be Cache Admin or wallet owner.
+		   Args: array containing
+args[0]               string   // Public Id Key of the actor
+args[1]               string   // Token Symbol
+
+// digestHash -> string
+// signature -> string
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) balanceOf(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: BALANCEOF FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENT.")
+	}
+
+	// Get balance //
+	balance, err := t.checkBalance(stub, args[0], args[1], true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	balanceBytes, _ := json.Marshal(balance)
+	return shim.Success(balanceBytes)
 }
 
 /* -------------------------------------------------------------------------------------------------
@@ -298,29 +908,208 @@ func (t *CoinBalanceSmartContract) initialiseBalance(stub shim.ChaincodeStubInte
 }
 
 /* -------------------------------------------------------------------------------------------------
-registerWallet: this function initialises a wallet for a pool
-Id                string    // Id of the address
+registerAddress: this function attaches a wallet address to an actor. It can only be invoked by
+                 the Data Protocol, which checks the consent of the actor, and needs the signature
+                 of the key of the address. Args: array containing a json with the following
+                 attributes:
+PublicId          string    // Public identifier of the actor
+Address           string    // Address to attach
+Nonce             uint64    // Next nonce of the address (see getNonce)
+Signature         string    // Signature of the operation digest by the address
 ------------------------------------------------------------------------------------------------- */
 
 func (t *CoinBalanceSmartContract) registerAddress(stub shim.ChaincodeStubInterface,
 	args []string) pb.Response {
 
-	// Check that wallet is not already registered //
-	addressExist := t.checkAddressExist(stub, args[0])
-	if addressExist {
-		return shim.Error("ERROR: ADDRESS " + args[0] +
+	err := checkInvokedByDataProtocol(stub, "registerAddress")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	operation, err := parseWalletOperation(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkWalletOperation(stub, ATTACH_ADDRESS_TYPE, operation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Check that wallet is not already attached to an actor //
+	wallet, addressExist, err := getWallet(stub, operation.Address)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if addressExist && wallet.PublicId != "" {
+		return shim.Error("ERROR: ADDRESS " + operation.Address +
 			" IS ALREADY REGISTERED IN THE SYSTEM.")
 	}
 
-	// Register new address on blockchain //
-	input, _ := json.Marshal([]byte(args[0]))
-	err := stub.PutState(IndexWallets+args[0], input)
+	// Register new address on blockchain, replacing the raw key of old addresses //
+	if addressExist {
+		err = stub.DelState(IndexWallets + operation.Address)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	wallet.PublicId = operation.PublicId
+	err = wallet.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	walletBytes, _ := json.Marshal(wallet)
+	return shim.Success(walletBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+unregisterAddress: this function detaches a wallet address from its actor. The address cannot hold
+                   any balance or credit. It can only be invoked by the Data Protocol, so that the
+                   addresses of the actor are kept in sync. Args: same json as registerAddress.
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) unregisterAddress(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	err := checkInvokedByDataProtocol(stub, "unregisterAddress")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	operation, err := parseWalletOperation(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkWalletOperation(stub, DETACH_ADDRESS_TYPE, operation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	wallet, err := getOwnedWallet(stub, operation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Check that no funds are left on the address //
+	balances, err := findAllBalacesOfAddress(stub, wallet.Address)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, balance := range balances {
+		if !balance.Amount.IsZero() || !balance.Credit.IsZero() {
+			return shim.Error("ERROR: THE ADDRESS " + wallet.Address + " STILL HOLDS " +
+				balance.Token + ". IT CANNOT BE DETACHED.")
+		}
+	}
+
+	compositeKey, err := wallet.ToCompositeKey(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(compositeKey)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 	return shim.Success(nil)
 }
 
+/* -------------------------------------------------------------------------------------------------
+confirmPrimaryAddress: this function checks that the key of an address attached to an actor signs
+                       its selection as primary address. It can only be invoked by the Data
+                       Protocol. Args: same json as registerAddress.
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) confirmPrimaryAddress(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	err := checkInvokedByDataProtocol(stub, "confirmPrimaryAddress")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	operation, err := parseWalletOperation(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkWalletOperation(stub, SET_PRIMARY_ADDRESS_TYPE, operation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	wallet, err := getOwnedWallet(stub, operation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	walletBytes, _ := json.Marshal(wallet)
+	return shim.Success(walletBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+approveAddress: this function checks that the primary address of an actor approves an address to be
+                attached to the actor or set as its primary address. It is invoked by the Data
+                Protocol when the caller is not the actor. Args: array containing a json with:
+PublicId          string    // Public identifier of the actor
+Address           string    // Primary address of the actor
+Approved          string    // Address approved by the primary address
+Nonce             uint64    // Next nonce of the primary address (see getNonce)
+Signature         string    // Signature of the approval digest by the primary address
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) approveAddress(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	operation, err := parseWalletOperation(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if operation.PublicId == "" || operation.Address == "" || operation.Approved == "" {
+		return shim.Error("ERROR: THE PUBLIC ID, THE ADDRESS AND THE APPROVED ADDRESS " +
+			"ARE REQUIRED.")
+	}
+	err = validateSignature(operation.Address, addressApprovalDigest(operation),
+		operation.Signature)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = useNonce(stub, operation.Address, operation.Nonce)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	wallet, err := getOwnedWallet(stub, operation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	walletBytes, _ := json.Marshal(wallet)
+	return shim.Success(walletBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+updateConfig: this function updates the configuration of the smart contract. Args: array containing
+              a json with the following attributes:
+MaxDateSkew             int64     // Max seconds between the client date of a transfer and the
+                                  // transaction timestamp
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) updateConfig(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: UPDATECONFIG FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	config := Config{}
+	err := json.Unmarshal([]byte(args[0]), &config)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	if config.MaxDateSkew <= 0 {
+		return shim.Error("ERROR: THE MAX DATE SKEW SHOULD BE POSITIVE.")
+	}
+
+	// Update configuration on Blockchain //
+	configBytes, _ := json.Marshal(config)
+	err = stub.PutState(IndexConfig, configBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(configBytes)
+}
+
 /* -------------------------------------------------------------------------------------------------
 initialiseFinancialScores: this function updates the Trust and Endorsement scores of an user
 publicId                string    // Id of the user  (args[0])
@@ -350,6 +1139,7 @@ func (t *CoinBalanceSmartContract) initialiseFinancialScores(stub shim.Chaincode
 	}
 
 	// Update user scores on Blockchain //
+	scores.DocType = DOC_TYPE_FINANCIAL_SCORES
 	scoresBytes, _ := json.Marshal(scores)
 	err := stub.PutState(IndexFinancialScores+args[0], scoresBytes)
 	if err != nil {
@@ -393,6 +1183,7 @@ func (t *CoinBalanceSmartContract) updateFinancialScores(stub shim.ChaincodeStub
 	}
 
 	// Update user scores on Blockchain //
+	scores.DocType = DOC_TYPE_FINANCIAL_SCORES
 	scoresBytes, _ := json.Marshal(scores)
 	err = stub.PutState(IndexFinancialScores+args[0], scoresBytes)
 	if err != nil {
@@ -409,13 +1200,15 @@ publicId                string    // Id of the user  (args[0])
 func (t *CoinBalanceSmartContract) getFinancialScores(stub shim.ChaincodeStubInterface,
 	args []string) pb.Response {
 
-	scoresBytes, err := stub.GetState(IndexFinancialScores + args[0])
-	if err != nil {
-		return shim.Error("ERROR: GETTING THE FINANCIAL SCORES OF THE USER")
+	if err := checkArgs(args, 1, "getFinancialScores"); err != nil {
+		return shim.Error(err.Error())
 	}
-	if scoresBytes == nil {
-		return shim.Error("ERROR: THE USER HAS NOT REGISTER FINANCIAL SCORES")
+
+	scores, err := loadFinancialScores(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
 	}
+	scoresBytes, _ := json.Marshal(scores)
 	return shim.Success(scoresBytes)
 }
 
@@ -428,6 +1221,10 @@ Type                    string    // Type of tokens to retrieve
 func (t *CoinBalanceSmartContract) getWalletType(stub shim.ChaincodeStubInterface,
 	args []string) pb.Response {
 
+	if err := checkArgs(args, 2, "getWalletType"); err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Get Token List //
 	tokenList, err := t.getTokenListByType(stub, args[1])
 	if err != nil {
@@ -450,558 +1247,2891 @@ func (t *CoinBalanceSmartContract) getWalletType(stub shim.ChaincodeStubInterfac
 
 /* -------------------------------------------------------------------------------------------------
 transfer: This function is called to transfer a given token from one wallet to another one.
+          The transfer fee of the token, if any, is paid by the sender to the treasury.
 Token              string   // Symbol of token to transfer
 From               string   // Id of the sender
 To                 string   // Id of the receiver
-Amount             float64  // Amount that is being sent
+Amount             string   // Amount that is being sent in base units
 Id                 string   // ID of the transaction
-Date               float64  // Date timestamp
+Date               int64    // Client date in seconds, replaced by the transaction timestamp
+Nonce              uint64   // Next nonce of the sender (see getNonce)
+Signature          string   // Signature of the transfer digest by the sender (args[1])
 ------------------------------------------------------------------------------------------------- */
 
 func (t *CoinBalanceSmartContract) transfer(stub shim.ChaincodeStubInterface,
 	args []string) pb.Response {
 
 	// Retrieve information from the input in a Transfer object //
-	// if len(args) != 1 {
-	// 	return shim.Error("ERROR: TRANSFER FUNCTION SHOULD BE CALLED " +
-	// 		"WITH ONE ARGUMENT.")
-	// }
+	if len(args) != 2 {
+		return shim.Error("ERROR: TRANSFER FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
 
 	transfer := Transfer{}
 	json.Unmarshal([]byte(args[0]), &transfer)
 
-	// Validate From transaction //
-	err := validateSignature(transfer.From, args[1], args[2])
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-
 	transactions := make(map[string]Transfer)
 	balances := make(map[string]Balance)
-	var check bool
 
 	// Check if transfer is possible //
-	err = t.checkTokenTransferConditions(stub, transfer.Token,
-		transfer.Date, transfer.Amount)
+	err := t.checkTokenTransferConditions(stub, &transfer)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
+	// Validate From transaction and consume its nonce //
+	err = validateSignature(transfer.From, transferDigest(transfer), args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = useNonce(stub, transfer.From, transfer.Nonce)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Reject transfers that were already processed //
+	err = checkTransactionNotProcessed(stub, transfer.Id)
+	if err != nil {
+		return errorResponse(err)
+	}
+
 	// Verify the sender and receiver are not the same //
 	if transfer.From == transfer.To {
 		return shim.Error("ERROR: SENDER AND RECEIVER CANNOT BE THE " +
 			" SAME IN A TRANSFER.")
 	}
 
-	// Retrieve balance of sender and receiver //
-	check = true
-	if transfer.AvoidCheckFrom {
-		check = false
+	// Transfer funds and charge fee //
+	err = t.moveFunds(stub, transfer, balances)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	senderBalance, err1 := t.checkBalance(stub, transfer.From, transfer.Token,
-		check)
-	if err1 != nil {
-		return shim.Error(err1.Error())
+	transfer.Type = "Transfer"
+	transactions[transfer.Id] = transfer
+	err = t.chargeTransferFee(stub, transfer, false, balances, transactions)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
-	check = true
-	if transfer.AvoidCheckTo {
-		check = false
+	// Update balances of sender, receiver and treasury //
+	err = t.updateBalances(stub, balances)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Register transactions as processed //
+	for _, transaction := range transactions {
+		err = recordTransaction(stub, transaction)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// Prepare output object with updates //
+	return generateOutput(stub, EVENT_TOKEN_TRANSFERRED, balances, nil, transactions)
+}
+
+/* -------------------------------------------------------------------------------------------------
+multitransfer: This function is called to perform a multitransfer between different actors in
+               one call to blockchain. Every distinct sender signs an envelope over its transfers
+               in the batch. Admins and exchanges can settle without envelopes. Transfer fees
+               are charged per transfer, operators with an exempt role of the fee schedule pay
+               no fee on the transfers they settle without envelope. Args:
+Transfers          []Transfer        // List of transfers (args[0])
+Envelopes          []SignedEnvelope  // Signed envelope of every sender (args[1], optional for operators)
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) multitransfer(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("ERROR: MULTITRANSFER FUNCTION SHOULD BE CALLED " +
+			"WITH ONE OR TWO ARGUMENTS.")
+	}
+	transferList := []Transfer{}
+	err := json.Unmarshal([]byte(args[0]), &transferList)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT TRANSFERS. " + err.Error())
+	}
+	envelopes := []SignedEnvelope{}
+	if len(args) == 2 {
+		err = json.Unmarshal([]byte(args[1]), &envelopes)
+		if err != nil {
+			return shim.Error("ERROR: GETTING INPUT ENVELOPES. " + err.Error())
+		}
+	}
+
+	// Check if transfers are allowed and group them by sender //
+	senderTransfers := make(map[string][]Transfer)
+	for i := range transferList {
+		err = t.checkTokenTransferConditions(stub, &transferList[i])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		sender := transferList[i].From
+		senderTransfers[sender] = append(senderTransfers[sender], transferList[i])
+	}
+
+	// Validate the envelopes of the senders //
+	signed, err := checkMultitransferSignatures(stub, senderTransfers, envelopes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Set of users participating in transfer and whose state should be updated //
+	transactions := make(map[string]Transfer)
+	balances := make(map[string]Balance)
+
+	// Iterate throught all the transactions on the multitransfer call //
+	for _, transfer := range transferList {
+
+		// Skip empty transfers //
+		if transfer.From == transfer.To || transfer.Amount.IsZero() {
+			continue
+		}
+
+		// Reject transfers that were already processed or repeated in the call //
+		if _, inBatch := transactions[transfer.Id]; inBatch {
+			return errorResponse(&DuplicateTransactionError{Id: transfer.Id})
+		}
+		err = checkTransactionNotProcessed(stub, transfer.Id)
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		// Check that the sender holds the amount to send and transfer funds //
+		err = t.moveFunds(stub, transfer, balances)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		transactions[transfer.Id] = transfer
+		err = t.chargeTransferFee(stub, transfer, !signed[transfer.From], balances,
+			transactions)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// Update States of all the users that did some transaction //
+	err = t.updateBalances(stub, balances)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Register transactions as processed //
+	for _, transfer := range transactions {
+		err = recordTransaction(stub, transfer)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// Prepare output object with updates //
+	return generateOutput(stub, EVENT_TOKEN_TRANSFERRED_BATCH, balances, nil, transactions)
+}
+
+/* -------------------------------------------------------------------------------------------------
+changeAllowance: This function is called by the owner of a balance to approve, increase or decrease
+                 the amount that a spender can transfer on its behalf. Args: array containing a json
+                 with the following attributes and the signature of the owner:
+Token              string   // Symbol of the token
+From               string   // Address of the owner
+To                 string   // Address of the spender
+Amount             string   // Amount in base units to approve, increase or decrease
+Id                 string   // ID of the transaction
+Nonce              uint64   // Next nonce of the owner (see getNonce)
+Signature          string   // Signature of the digest of the operation by the owner (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) changeAllowance(stub shim.ChaincodeStubInterface,
+	args []string, operationType string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: ALLOWANCE FUNCTIONS SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+	input := Transfer{}
+	json.Unmarshal([]byte(args[0]), &input)
+
+	// Check if the token allows the operation //
+	err := t.checkTokenTransferConditions(stub, &input)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Validate signature of the owner and consume its nonce //
+	err = validateSignature(input.From, typedTransferDigest(operationType, input), args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = useNonce(stub, input.From, input.Nonce)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Reject operations that were already processed //
+	err = checkTransactionNotProcessed(stub, input.Id)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if input.From == input.To {
+		return shim.Error("ERROR: OWNER AND SPENDER CANNOT BE THE SAME " +
+			"IN AN ALLOWANCE.")
+	}
+
+	// Update allowance of the spender //
+	allowance, err := getAllowance(stub, input.From, input.To, input.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	switch operationType {
+	case APPROVE_TYPE:
+		allowance.Amount = input.Amount
+		input.Type = "Approve"
+	case INCREASE_ALLOWANCE_TYPE:
+		allowance.Amount, err = saveAddition(allowance.Amount, input.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		input.Type = "IncreaseAllowance"
+	case DECREASE_ALLOWANCE_TYPE:
+		if allowance.Amount.Cmp(input.Amount) < 0 {
+			return shim.Error("ERROR: THE ALLOWANCE CANNOT BE DECREASED " +
+				"BELOW ZERO.")
+		}
+		allowance.Amount = allowance.Amount.Sub(input.Amount)
+		input.Type = "DecreaseAllowance"
+	}
+	err = saveTokenState(stub, allowance.Token, &allowance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Register transaction as processed //
+	err = recordTransaction(stub, input)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{
+		Transactions:     map[string]Transfer{input.Id: input},
+		UpdateAllowances: map[string]Allowance{input.From + " " + input.To + " " + input.Token: allowance}}
+	return outputResponse(stub, EVENT_ALLOWANCE_CHANGED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+allowance: this function retrieves the amount that a spender can transfer on behalf of an owner
+Owner                 string    // Address of the owner (args[0])
+Spender               string    // Address of the spender (args[1])
+Token                 string    // Symbol of the token (args[2])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) allowance(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 3 {
+		return shim.Error("ERROR: ALLOWANCE FUNCTION SHOULD BE CALLED " +
+			"WITH THREE ARGUMENTS.")
+	}
+
+	allowance, err := getAllowance(stub, args[0], args[1], args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	allowanceBytes, _ := json.Marshal(allowance)
+	return shim.Success(allowanceBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+transferFrom: This function is called by a spender to transfer tokens of an owner to a receiver
+              within the allowance approved by the owner. Args: array containing a json with the
+              following attributes and the signature of the spender:
+Token              string   // Symbol of token to transfer
+From               string   // Address of the owner
+To                 string   // Address of the receiver
+Spender            string   // Address of the spender
+Amount             string   // Amount that is being sent in base units
+Id                 string   // ID of the transaction
+Nonce              uint64   // Next nonce of the spender (see getNonce)
+Signature          string   // Signature of the transfer digest by the spender (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) transferFrom(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input in a Transfer object //
+	if len(args) != 2 {
+		return shim.Error("ERROR: TRANSFERFROM FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+	transfer := Transfer{}
+	json.Unmarshal([]byte(args[0]), &transfer)
+	balances := make(map[string]Balance)
+
+	// Check if transfer is possible //
+	err := t.checkTokenTransferConditions(stub, &transfer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Validate signature of the spender and consume its nonce //
+	err = validateSignature(transfer.Spender, transferFromDigest(transfer), args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = useNonce(stub, transfer.Spender, transfer.Nonce)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Reject transfers that were already processed //
+	err = checkTransactionNotProcessed(stub, transfer.Id)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Verify the sender and receiver are not the same //
+	if transfer.From == transfer.To {
+		return shim.Error("ERROR: SENDER AND RECEIVER CANNOT BE THE " +
+			" SAME IN A TRANSFER.")
+	}
+
+	// Consume allowance of the spender //
+	allowance, err := getAllowance(stub, transfer.From, transfer.Spender, transfer.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if allowance.Amount.Cmp(transfer.Amount) < 0 {
+		return shim.Error("ERROR: INSUFFICIENT ALLOWANCE OF " + transfer.Spender +
+			" OVER THE BALANCE OF " + transfer.From)
+	}
+	allowance.Amount = allowance.Amount.Sub(transfer.Amount)
+
+	// Transfer funds //
+	err = t.moveFunds(stub, transfer, balances)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	transfer.Type = "TransferFrom"
+
+	// Update balances and allowance //
+	err = t.updateBalances(stub, balances)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = allowance.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Register transaction as processed //
+	err = recordTransaction(stub, transfer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{
+		UpdateBalances:   balances,
+		Transactions:     map[string]Transfer{transfer.Id: transfer},
+		UpdateAllowances: map[string]Allowance{transfer.From + " " + transfer.Spender + " " + transfer.Token: allowance}}
+	return outputResponse(stub, EVENT_TOKEN_TRANSFERRED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+grantCredit: This function is called by an admin or a guarantor to grant (or update) the credit
+             limit of an address for a token. Transfers of the address can overdraw up to the
+             limit weighted by the TrustScore of the user. Args: array containing a json with:
+Address            string   // Address receiving the credit line
+Token              string   // Symbol of the token
+PublicId           string   // Id of the user whose financial scores back the credit line
+Limit              string   // Credit limit in base units (0 revokes the credit line)
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) grantCredit(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: GRANTCREDIT FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	creditLine := CreditLine{}
+	err := json.Unmarshal([]byte(args[0]), &creditLine)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+
+	// Convert limit to base units of the token //
+	token, err := t.getToken(stub, creditLine.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = creditLine.Limit.Resolve(token.Decimals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if creditLine.Limit.Sign() < 0 {
+		return shim.Error("ERROR: THE CREDIT LIMIT CANNOT BE NEGATIVE.")
+	}
+
+	// Check that the address and the scores of the user exist //
+	if !t.checkAddressExist(stub, creditLine.Address) {
+		return shim.Error("ERROR: THE ADDRESS FOR " + creditLine.Address +
+			" IS NOT REGISTERED.")
+	}
+	_, err = loadFinancialScores(stub, creditLine.PublicId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Store credit line with its grantor //
+	creditLine.Grantor, err = cid.GetID(stub)
+	if err != nil {
+		return shim.Error("ERROR: GETTING THE IDENTITY OF THE GRANTOR. " + err.Error())
+	}
+	err = saveTokenState(stub, creditLine.Token, &creditLine)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{UpdateCreditLines: map[string]CreditLine{
+		creditLine.Address + " " + creditLine.Token: creditLine}}
+	return outputResponse(stub, EVENT_CREDIT_LINE_GRANTED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+getCreditLine: this function retrieves the credit line of an address for a token with the
+               outstanding and available credit
+Address               string    // Address of the credit line (args[0])
+Token                 string    // Symbol of the token (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) getCreditLine(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: GETCREDITLINE FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+
+	balance, err := t.checkBalance(stub, args[0], args[1], false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	status, err := getCreditStatus(stub, balance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	statusBytes, _ := json.Marshal(status)
+	return shim.Success(statusBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+revokeVesting: This function is called by an admin to revoke a revocable vesting schedule. The
+               amount vested so far stays on the holder balance and the unvested amount is
+               burned from the balance and the supply of the token.
+Address               string    // Address of the holder (args[0])
+Token                 string    // Symbol of the token (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) revokeVesting(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: REVOKEVESTING FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+
+	// Retrieve schedule at the current timestamp //
+	status, isLoaded, err := getVestingStatus(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isLoaded {
+		return shim.Error("ERROR: THE ADDRESS " + args[0] + " HAS NO VESTING " +
+			"SCHEDULE FOR " + args[1])
+	}
+	schedule := status.VestingSchedule
+	if !schedule.Revocable || schedule.Revoked {
+		return shim.Error("ERROR: THE VESTING SCHEDULE CANNOT BE REVOKED.")
+	}
+
+	// Burn unvested funds from holder balance //
+	balance, err := t.checkBalance(stub, args[0], args[1], true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	unvested := MinAmount(status.Locked, balance.Amount)
+	balance.Amount, err = saveSubstraction(balance.Amount, unvested)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	balance.LockUpDate = 0
+	err = t.updateBalance(stub, balance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	token, err := t.getToken(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	token.Supply, err = saveSubstraction(token.Supply, unvested)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = t.updateToken(stub, token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Keep only the vested amount on the schedule //
+	schedule.Total = status.Unlocked
+	schedule.Revoked = true
+	err = schedule.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	balances := map[string]Balance{balance.Address + " " + balance.Token: balance}
+	tokens := map[string]Token{token.Symbol: token}
+	return generateOutput(stub, EVENT_TOKEN_BURNED, balances, tokens, nil)
+}
+
+/* -------------------------------------------------------------------------------------------------
+getVestingSchedule: this function retrieves the vesting schedule of an address for a token with
+                    the locked and unlocked amounts at the timestamp of the transaction
+Address               string    // Address of the holder (args[0])
+Token                 string    // Symbol of the token (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) getVestingSchedule(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: GETVESTINGSCHEDULE FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+
+	status, isLoaded, err := getVestingStatus(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isLoaded {
+		return shim.Error("ERROR: THE ADDRESS " + args[0] + " HAS NO VESTING " +
+			"SCHEDULE FOR " + args[1])
+	}
+	statusBytes, _ := json.Marshal(status)
+	return shim.Success(statusBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+setCreditPool: This function is called by an admin to register a credit pool or to update the
+               premium of a registered one. The funds lent by the pool are held by its Address.
+               Args: array containing a json with:
+Id                 string   // Id of the credit pool
+Token              string   // Symbol of the token lent by the pool
+Address            string   // Address holding the funds of the pool
+PremiumAddress     string   // Address receiving the premiums charged by the pool
+PremiumRate        float64  // Premium charged on the credit drawn, between 0 and 1
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) setCreditPool(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: SETCREDITPOOL FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	input := CreditPool{}
+	err := json.Unmarshal([]byte(args[0]), &input)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	if input.Id == "" {
+		return shim.Error("ERROR: THE ID OF THE CREDIT POOL CANNOT BE EMPTY.")
+	}
+	err = checkTransactionId(input.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !checkRange(input.PremiumRate, 0., 1.) {
+		return shim.Error("ERROR: THE PREMIUM RATE SHOULD BE BETWEEN 0 AND 1.")
+	}
+	_, err = t.getToken(stub, input.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, address := range []string{input.Address, input.PremiumAddress} {
+		if !t.checkAddressExist(stub, address) {
+			return shim.Error("ERROR: THE ADDRESS FOR " + address + " IS NOT REGISTERED.")
+		}
+	}
+
+	// Keep the token, funds and totals of a registered pool //
+	pool := CreditPool{Id: input.Id}
+	isLoaded, err := pool.LoadState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isLoaded {
+		pool = CreditPool{
+			Id: input.Id, Token: input.Token, Address: input.Address,
+			TotalLent: NewAmount(0), TotalPremium: NewAmount(0)}
+	}
+	if pool.Token != input.Token || pool.Address != input.Address {
+		return shim.Error("ERROR: THE TOKEN AND ADDRESS OF THE CREDIT POOL " +
+			input.Id + " CANNOT BE CHANGED.")
+	}
+	pool.PremiumAddress = input.PremiumAddress
+	pool.PremiumRate = input.PremiumRate
+	err = pool.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{UpdateCreditPools: map[string]CreditPool{pool.Id: pool}}
+	return outputResponse(stub, EVENT_CREDIT_POOL_UPDATED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+grantPoolCredit: This function is called by an admin or a guarantor to grant (or update) the credit
+                 limit of an address in a credit pool. Args: array containing a json with:
+Address            string   // Address receiving the credit
+PoolId             string   // Id of the credit pool
+Limit              string   // Credit limit in base units, including the premiums
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) grantPoolCredit(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: GRANTPOOLCREDIT FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	input := PoolCredit{}
+	err := json.Unmarshal([]byte(args[0]), &input)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	pool, err := getCreditPool(stub, input.PoolId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	token, err := t.getToken(stub, pool.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = input.Limit.Resolve(token.Decimals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if input.Limit.Sign() < 0 {
+		return shim.Error("ERROR: THE CREDIT LIMIT CANNOT BE NEGATIVE.")
+	}
+	if !t.checkAddressExist(stub, input.Address) {
+		return shim.Error("ERROR: THE ADDRESS FOR " + input.Address +
+			" IS NOT REGISTERED.")
+	}
+
+	// Keep the credit already drawn from the pool //
+	credit := PoolCredit{Address: input.Address, Token: pool.Token, PoolId: pool.Id}
+	isLoaded, err := credit.LoadState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isLoaded {
+		credit.Drawn = NewAmount(0)
+	}
+	credit.Limit = input.Limit
+	err = credit.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{UpdatePoolCredits: map[string]PoolCredit{
+		credit.Address + " " + credit.Token + " " + credit.PoolId: credit}}
+	return outputResponse(stub, EVENT_CREDIT_LINE_GRANTED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+spendFunds: This function is called when a user wants to pay a provider. The unlocked funds of the
+            spender are used first and the rest is drawn from the credit pools of the spender in
+            order of their Id. Each pool pays the provider from its funds and its premium to its
+            premium address, and the spender owes the pool both until it calls repayPoolCredit.
+            Every leg is recorded as a Transfer: the Spending one with the Id of the input and the
+            Credit and Premium ones with the Id suffixed by the Id of the pool.
+            Args: a json with a Transfer signed by From
+Token              string   // Symbol of token to spend
+From               string   // Address of the fund spender
+To                 string   // Address of the provider
+Amount             string   // Amount to spend in base units
+Id                 string   // ID of the spending
+Date               int64    // Client date in seconds, replaced by the transaction timestamp
+Nonce              uint64   // Next nonce of the spender
+Signature          string   // Signature of the spending by the spender (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) spendFunds(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: SPENDFUNDS FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+	spending := Transfer{}
+	json.Unmarshal([]byte(args[0]), &spending)
+
+	// Check if transfer is possible //
+	err := t.checkTokenTransferConditions(stub, &spending)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Validate spender and consume its nonce //
+	err = validateSignature(spending.From,
+		typedTransferDigest(SPEND_FUNDS_TYPE, spending), args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = useNonce(stub, spending.From, spending.Nonce)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkTransactionNotProcessed(stub, spending.Id)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if spending.From == spending.To {
+		return shim.Error("ERROR: SPENDER AND PROVIDER CANNOT BE THE SAME.")
+	}
+
+	balances := make(map[string]Balance)
+	transactions := make(map[string]Transfer)
+	pools := make(map[string]CreditPool)
+	credits := make(map[string]PoolCredit)
+	premiums := make(map[string]Premium)
+
+	spenderBalance, err := t.checkBalance(stub, spending.From, spending.Token, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	providerBalance, err := t.checkBalance(stub, spending.To, spending.Token, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	balances[spending.From+" "+spending.Token] = spenderBalance
+	balances[spending.To+" "+spending.Token] = providerBalance
+
+	// Charge first the unlocked funds of the spender //
+	locked, err := getLockedAmount(stub, spenderBalance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ownFunds := MinAmount(spending.Amount,
+		spenderBalance.Amount.Sub(MinAmount(locked, spenderBalance.Amount)))
+	transfer := spending
+	transfer.Type = "Spending"
+	transfer.Amount = ownFunds
+	err = t.moveFundsWithoutCredit(stub, transfer, balances)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	transactions[transfer.Id] = transfer
+
+	// Draw the credit needed to pay remaining from the credit pools //
+	creditNeeded := spending.Amount.Sub(ownFunds)
+	poolCredits := []PoolCredit{}
+	if creditNeeded.Sign() > 0 {
+		poolCredits, err = getPoolCredits(stub, spending.From, spending.Token)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	for _, credit := range poolCredits {
+		if creditNeeded.Sign() <= 0 {
+			break
+		}
+		pool, err := getCreditPool(stub, credit.PoolId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		poolBalance, inList := balances[pool.Address+" "+pool.Token]
+		if !inList {
+			poolBalance, err = t.checkBalance(stub, pool.Address, pool.Token, true)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		draw, premium := drawPoolCredit(pool, credit, poolBalance.Amount, creditNeeded)
+		if draw.Sign() <= 0 {
+			continue
+		}
+
+		// Pay provider and premium from the funds of the pool //
+		creditTransfer := Transfer{
+			Type: "Credit", Token: spending.Token, From: pool.Address, To: spending.To,
+			Amount: draw, Id: transactionLegId(spending.Id, pool.Id), Date: spending.Date,
+			Spender: spending.From}
+		premiumTransfer := Transfer{
+			Type: "Premium", Token: spending.Token, From: pool.Address,
+			To: pool.PremiumAddress, Amount: premium,
+			Id: transactionLegId(spending.Id, pool.Id, "premium"), Date: spending.Date,
+			Spender: spending.From}
+		for _, leg := range []Transfer{creditTransfer, premiumTransfer} {
+			err = t.moveFundsWithoutCredit(stub, leg, balances)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			err = addTransactionLeg(stub, transactions, leg)
+			if err != nil {
+				return errorResponse(err)
+			}
+		}
+
+		// Update debt of the spender with the pool //
+		credit.Drawn = credit.Drawn.Add(draw).Add(premium)
+		pool.TotalLent = pool.TotalLent.Add(draw).Add(premium)
+		pool.TotalPremium = pool.TotalPremium.Add(premium)
+		credits[credit.Address+" "+credit.Token+" "+credit.PoolId] = credit
+		pools[pool.Id] = pool
+		premiums[pool.Id] = Premium{
+			PoolId: pool.Id, TxnId: spending.Id, Spender: spending.From,
+			Provider: spending.To, Token: spending.Token, Credit: draw,
+			PremiumRate: pool.PremiumRate, Amount: premium, Date: spending.Date}
+		creditNeeded = creditNeeded.Sub(draw)
+	}
+	if creditNeeded.Sign() > 0 {
+		return shim.Error("ERROR: THE SPENDER " + spending.From + " DOES NOT HAVE " +
+			"ENOUGH FUNDS TO SPEND.")
+	}
+
+	// Update balances, credit pools and premiums on Blockchain //
+	err = t.updateBalances(stub, balances)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, credit := range credits {
+		err = credit.SaveState(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	for _, pool := range pools {
+		err = pool.SaveState(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	for _, premium := range premiums {
+		err = premium.SaveState(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	for _, leg := range transactions {
+		err = recordTransaction(stub, leg)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// Prepare output object with updates //
+	output := Output{
+		UpdateBalances: balances, Transactions: transactions,
+		UpdateCreditPools: pools, UpdatePoolCredits: credits, Premiums: premiums}
+	return outputResponse(stub, EVENT_FUNDS_SPENT, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+repayPoolCredit: This function is called when a user wants to repay the credit drawn from a credit
+                 pool. The unlocked funds of the user are moved to the Address of the pool and the
+                 amount is substracted from the credit Drawn by the user and the TotalLent of the
+                 pool, so the credit can be drawn again. The repayment is recorded as a Transfer to
+                 the Address of the pool. Args: a json with a Transfer signed by From
+Token              string   // Symbol of token lent by the pool
+From               string   // Address of the borrower
+To                 string   // Id of the credit pool
+Amount             string   // Amount to repay in base units, up to the credit drawn
+Id                 string   // ID of the repayment
+Date               int64    // Client date in seconds, replaced by the transaction timestamp
+Nonce              uint64   // Next nonce of the borrower
+Signature          string   // Signature of the repayment by the borrower (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) repayPoolCredit(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: REPAYPOOLCREDIT FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+	repayment := Transfer{}
+	json.Unmarshal([]byte(args[0]), &repayment)
+
+	// Check if transfer is possible //
+	err := t.checkTokenTransferConditions(stub, &repayment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Validate borrower and consume its nonce //
+	err = validateSignature(repayment.From,
+		typedTransferDigest(REPAY_POOL_CREDIT_TYPE, repayment), args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = useNonce(stub, repayment.From, repayment.Nonce)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkTransactionNotProcessed(stub, repayment.Id)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Retrieve the credit drawn from the pool //
+	pool, err := getCreditPool(stub, repayment.To)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if pool.Token != repayment.Token {
+		return shim.Error("ERROR: THE CREDIT POOL " + pool.Id + " DOES NOT LEND " +
+			repayment.Token + ".")
+	}
+	credit := PoolCredit{Address: repayment.From, Token: pool.Token, PoolId: pool.Id}
+	isLoaded, err := credit.LoadState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isLoaded || repayment.Amount.Cmp(credit.Drawn) > 0 {
+		return shim.Error("ERROR: THE AMOUNT TO REPAY EXCEEDS THE CREDIT DRAWN BY " +
+			repayment.From + " FROM THE CREDIT POOL " + pool.Id + ".")
+	}
+	if repayment.From == pool.Address {
+		return shim.Error("ERROR: THE ADDRESS OF THE CREDIT POOL CANNOT REPAY ITSELF.")
+	}
+
+	// Pay the pool from the unlocked funds of the borrower //
+	balances := make(map[string]Balance)
+	transfer := repayment
+	transfer.Type = "Repayment"
+	transfer.To = pool.Address
+	err = t.moveFundsWithoutCredit(stub, transfer, balances)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Update debt of the borrower with the pool //
+	credit.Drawn = credit.Drawn.Sub(transfer.Amount)
+	pool.TotalLent = pool.TotalLent.Sub(transfer.Amount)
+
+	// Update balances, credit pool and transaction on Blockchain //
+	err = t.updateBalances(stub, balances)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = credit.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = pool.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = recordTransaction(stub, transfer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{
+		UpdateBalances: balances, Transactions: map[string]Transfer{transfer.Id: transfer},
+		UpdateCreditPools: map[string]CreditPool{pool.Id: pool},
+		UpdatePoolCredits: map[string]PoolCredit{
+			credit.Address + " " + credit.Token + " " + credit.PoolId: credit}}
+	return outputResponse(stub, EVENT_POOL_CREDIT_REPAID, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+getPoolCredits: this function retrieves the credit granted to an address for a token by every
+                credit pool
+Address               string    // Address of the borrower (args[0])
+Token                 string    // Symbol of the token (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) getPoolCredits(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: GETPOOLCREDITS FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+	credits, err := getPoolCredits(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	creditsBytes, _ := json.Marshal(credits)
+	return shim.Success(creditsBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+createAirdrop: This function is called by an admin to publish the Keccak Merkle root of an airdrop.
+               The total amount of the airdrop is escrowed from the balance of the funder until it
+               is claimed or reclaimed after the expiry. Args: array containing a json with:
+Id                 string   // Id of the airdrop
+Token              string   // Symbol of the token to airdrop
+Root               string   // Hex Merkle root of the leaves (index, address, amount)
+Funder             string   // Address funding the airdrop
+Total              string   // Total amount of the leaves in base units
+Expiry             int64    // Timestamp in seconds after which the airdrop cannot be claimed
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) createAirdrop(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: CREATEAIRDROP FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	airdrop := Airdrop{}
+	err := json.Unmarshal([]byte(args[0]), &airdrop)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	err = checkTransactionNotProcessed(stub, airdrop.Id)
+	if err != nil {
+		return errorResponse(err)
+	}
+	_, err = getAirdrop(stub, airdrop.Id)
+	if err == nil {
+		return shim.Error("ERROR: THE AIRDROP " + airdrop.Id + " IS ALREADY PUBLISHED.")
+	}
+	rootBytes, err := hexutil.Decode(airdrop.Root)
+	if err != nil || len(rootBytes) != 32 {
+		return shim.Error("ERROR: THE MERKLE ROOT SHOULD BE A HEX STRING OF 32 BYTES.")
+	}
+
+	// Check token and amount of the airdrop //
+	token, err := t.getToken(stub, airdrop.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkTokenStatus(token, TOKEN_ACTIVE)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = airdrop.Total.Resolve(token.Decimals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if airdrop.Total.Sign() <= 0 {
+		return shim.Error("ERROR: THE TOTAL AMOUNT OF THE AIRDROP SHOULD BE POSITIVE.")
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if airdrop.Expiry <= timestamp {
+		return shim.Error("ERROR: THE EXPIRY OF THE AIRDROP SHOULD BE IN THE FUTURE.")
+	}
+
+	// Escrow total amount from the funder //
+	funderBalance, err := t.checkBalance(stub, airdrop.Funder, airdrop.Token, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	funderBalance, err = withdrawFromBalance(stub, funderBalance, airdrop.Total, NewAmount(0))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = t.updateBalance(stub, funderBalance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	airdrop.Remaining = airdrop.Total
+	err = saveAirdrop(stub, airdrop)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	transfer := Transfer{
+		Type: "Airdrop", Token: airdrop.Token, From: airdrop.Funder,
+		Amount: airdrop.Total, Id: airdrop.Id, Date: timestamp}
+	err = recordTransaction(stub, transfer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{
+		UpdateBalances: map[string]Balance{funderBalance.Address + " " + funderBalance.Token: funderBalance},
+		Transactions:   map[string]Transfer{transfer.Id: transfer},
+		UpdateAirdrops: map[string]Airdrop{airdrop.Id: airdrop}}
+	return outputResponse(stub, EVENT_AIRDROP_CREATED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+claim: This function is called to claim the amount of a leaf of an airdrop before its expiry. The
+       leaf is verified against the Merkle root of the airdrop and marked as claimed.
+       Args: array containing a json with:
+AirdropId          string    // Id of the airdrop
+Index              uint64    // Index of the leaf in the airdrop
+Address            string    // Address receiving the tokens
+Amount             string    // Amount of the leaf in base units
+Proof              []string  // Hex nodes of the Merkle proof of the leaf
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) claim(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: CLAIM FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	input := AirdropClaim{}
+	err := json.Unmarshal([]byte(args[0]), &input)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	airdrop, err := getAirdrop(stub, input.AirdropId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	token, err := t.getToken(stub, airdrop.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkTokenStatus(token, TOKEN_ACTIVE)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = input.Amount.Resolve(token.Decimals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if timestamp >= airdrop.Expiry {
+		return shim.Error("ERROR: THE AIRDROP " + airdrop.Id + " HAS EXPIRED.")
+	}
+
+	// Verify leaf and that it was not claimed //
+	isValid, err := verifyMerkleProof(airdrop.Root,
+		airdropLeaf(input.Index, input.Address, input.Amount), input.Proof)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isValid {
+		return shim.Error("ERROR: THE MERKLE PROOF OF THE CLAIM IS NOT VALID.")
+	}
+	isClaimed, err := isAirdropClaimed(stub, airdrop.Id, input.Index)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if isClaimed {
+		return shim.Error(fmt.Sprintf("ERROR: THE LEAF %d OF THE AIRDROP %s IS "+
+			"ALREADY CLAIMED.", input.Index, airdrop.Id))
+	}
+	err = setAirdropClaimed(stub, airdrop.Id, input.Index)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Release claimed amount from the escrow //
+	airdrop.Remaining, err = saveSubstraction(airdrop.Remaining, input.Amount)
+	if err != nil {
+		return shim.Error("ERROR: THE AIRDROP " + airdrop.Id + " HAS NOT ENOUGH " +
+			"FUNDS LEFT. " + err.Error())
+	}
+	err = saveAirdrop(stub, airdrop)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	balance, err := t.checkBalance(stub, input.Address, airdrop.Token, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	balance.Amount, balance.Credit, err = saveCreditAddition(
+		balance.Amount, balance.Credit, input.Amount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = t.updateBalance(stub, balance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	transfer := Transfer{
+		Type: "Claim", Token: airdrop.Token, To: input.Address, Amount: input.Amount,
+		Id: transactionLegId(airdrop.Id, fmt.Sprint(input.Index)), Date: timestamp}
+	err = checkTransactionLegNotProcessed(stub, transfer.Id)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = recordTransaction(stub, transfer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{
+		UpdateBalances: map[string]Balance{balance.Address + " " + balance.Token: balance},
+		Transactions:   map[string]Transfer{transfer.Id: transfer},
+		UpdateAirdrops: map[string]Airdrop{airdrop.Id: airdrop}}
+	return outputResponse(stub, EVENT_AIRDROP_CLAIMED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+reclaimAirdrop: This function is called by an admin after the expiry of an airdrop to return its
+                unclaimed amount to the funder. The airdrops of a delisting token can be reclaimed
+                before their expiry, so that their escrow is redeemed with the other balances.
+AirdropId          string    // Id of the airdrop (args[0])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) reclaimAirdrop(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: RECLAIMAIRDROP FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	airdrop, err := getAirdrop(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	token, err := t.getToken(stub, airdrop.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkTokenStatus(token, TOKEN_ACTIVE, TOKEN_DELISTING)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if timestamp < airdrop.Expiry && token.Status != TOKEN_DELISTING {
+		return shim.Error("ERROR: THE AIRDROP " + airdrop.Id + " HAS NOT EXPIRED YET.")
+	}
+	if airdrop.Remaining.IsZero() {
+		return shim.Error("ERROR: THE AIRDROP " + airdrop.Id + " HAS NO UNCLAIMED FUNDS.")
+	}
+
+	// Return unclaimed amount to the funder //
+	balance, err := t.checkBalance(stub, airdrop.Funder, airdrop.Token, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	balance.Amount, balance.Credit, err = saveCreditAddition(
+		balance.Amount, balance.Credit, airdrop.Remaining)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = t.updateBalance(stub, balance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	transfer := Transfer{
+		Type: "Reclaim", Token: airdrop.Token, To: airdrop.Funder,
+		Amount: airdrop.Remaining, Id: transactionLegId(airdrop.Id, "reclaim"), Date: timestamp}
+	err = checkTransactionLegNotProcessed(stub, transfer.Id)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = recordTransaction(stub, transfer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	airdrop.Remaining = NewAmount(0)
+	err = saveAirdrop(stub, airdrop)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{
+		UpdateBalances: map[string]Balance{balance.Address + " " + balance.Token: balance},
+		Transactions:   map[string]Transfer{transfer.Id: transfer},
+		UpdateAirdrops: map[string]Airdrop{airdrop.Id: airdrop}}
+	return outputResponse(stub, EVENT_AIRDROP_RECLAIMED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+auditToken: This function is called by an admin to reconcile the supply of a token with the sum of
+            its balances, the credit outstanding and the amounts escrowed. It returns the audit
+            with its discrepancy and, when requested, stores it on the ledger with the identity
+            of the auditor.
+Symbol             string   // Symbol of the token (args[0])
+Store              string   // "true" to store the audit and its digest (args[1], optional)
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) auditToken(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("ERROR: AUDITTOKEN FUNCTION SHOULD BE CALLED " +
+			"WITH ONE OR TWO ARGUMENTS.")
+	}
+	token, err := t.getToken(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	audit, err := reconcileToken(stub, token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Store audit record with its digest //
+	if len(args) == 2 && args[1] == "true" {
+		audit, err = digestAudit(stub, audit)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = audit.SaveState(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		output := Output{Audits: map[string]TokenAudit{audit.Token: audit}}
+		err = emitEvent(stub, EVENT_TOKEN_AUDITED, output)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	auditBytes, _ := json.Marshal(audit)
+	return shim.Success(auditBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+setFeeSchedule: This function is called by an admin to set the fee charged on the transfers and
+                multitransfers of a token. Args: array containing a json with:
+Token              string    // Symbol of the token
+Treasury           string    // Address receiving the fees
+FlatFee            string    // Flat fee of every transfer in base units
+BasisPoints        int64     // Fee in basis points of the amount transferred
+MinFee             string    // Minimum of the basis points fee in base units
+MaxFee             string    // Maximum of the basis points fee in base units (0 for no max)
+ExemptRoles        []string  // Roles of the operators whose settlements without envelope pay no fee
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) setFeeSchedule(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: SETFEESCHEDULE FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	schedule := FeeSchedule{}
+	err := json.Unmarshal([]byte(args[0]), &schedule)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+
+	// Convert fees to base units of the token //
+	token, err := t.getToken(stub, schedule.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, fee := range []*Amount{&schedule.FlatFee, &schedule.MinFee, &schedule.MaxFee} {
+		err = fee.Resolve(token.Decimals)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if fee.Sign() < 0 {
+			return shim.Error("ERROR: THE FEES CANNOT BE NEGATIVE.")
+		}
+	}
+	if schedule.BasisPoints < 0 || schedule.BasisPoints > BASIS_POINTS {
+		return shim.Error(fmt.Sprintf("ERROR: THE BASIS POINTS OF THE FEE SHOULD BE "+
+			"BETWEEN 0 AND %d.", BASIS_POINTS))
+	}
+	if schedule.MaxFee.Sign() > 0 && schedule.MaxFee.Cmp(schedule.MinFee) < 0 {
+		return shim.Error("ERROR: THE MAXIMUM FEE CANNOT BE LOWER THAN THE MINIMUM FEE.")
+	}
+
+	// Check if integer condition if we have an NFT Pod Token //
+	if token.TokenType == NFT_POD_TOKEN {
+		for _, fee := range []Amount{schedule.FlatFee, schedule.MinFee, schedule.MaxFee} {
+			if !fee.IsWhole(token.Decimals) {
+				return shim.Error("ERROR: THE FEES OF NFT POD TOKEN " +
+					schedule.Token + " SHOULD BE INTEGERS.")
+			}
+		}
+	}
+	if !t.checkAddressExist(stub, schedule.Treasury) {
+		return shim.Error("ERROR: THE ADDRESS FOR " + schedule.Treasury +
+			" IS NOT REGISTERED.")
+	}
+
+	// Update fee schedule on Blockchain //
+	err = saveTokenState(stub, schedule.Token, &schedule)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	scheduleBytes, _ := json.Marshal(schedule)
+	return shim.Success(scheduleBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+setMinterQuota: This function is called by an admin to allow a minter identity to mint a token up
+                to a quota per period. Updating a quota with the same period keeps the amount
+                already minted in the current period. Args: array containing a json with:
+Minter             string    // Identity of the minter as MSPID::ID (see getIdentity)
+Token              string    // Symbol of the token
+Quota              string    // Amount that can be minted per period in base units
+Period             int64     // Length of the period in seconds (0 for a quota that never resets)
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) setMinterQuota(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: SETMINTERQUOTA FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	input := MinterQuota{}
+	err := json.Unmarshal([]byte(args[0]), &input)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	if input.Minter == "" {
+		return shim.Error("ERROR: THE MINTER CANNOT BE EMPTY.")
+	}
+	if input.Period < 0 {
+		return shim.Error("ERROR: THE PERIOD OF THE QUOTA CANNOT BE NEGATIVE.")
+	}
+
+	// Convert quota to base units of the token //
+	token, err := t.getToken(stub, input.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = input.Quota.Resolve(token.Decimals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if input.Quota.Sign() < 0 {
+		return shim.Error("ERROR: THE QUOTA OF A MINTER CANNOT BE NEGATIVE.")
+	}
+
+	// Keep the current period of the quota if its length does not change //
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	quota, isSet, err := getMinterQuota(stub, input.Minter, input.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isSet || quota.Period != input.Period {
+		quota.Period = input.Period
+		quota.PeriodStart = timestamp
+		quota.Minted = NewAmount(0)
+	}
+	quota.Quota = input.Quota
+	refreshMinterQuota(&quota, timestamp)
+
+	// Update minter quota on Blockchain //
+	err = saveTokenState(stub, quota.Token, &quota)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	output := Output{UpdateMinterQuotas: map[string]MinterQuota{
+		quota.Minter + " " + quota.Token: quota}}
+	return outputResponse(stub, EVENT_MINTER_QUOTA_UPDATED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+removeMinterQuota: This function is called by an admin to revoke the quota of a minter for a token.
+Minter             string    // Identity of the minter as MSPID::ID (args[0])
+Token              string    // Symbol of the token (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) removeMinterQuota(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: REMOVEMINTERQUOTA FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+	quota, isSet, err := getMinterQuota(stub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isSet {
+		return shim.Error("ERROR: THE MINTER " + args[0] + " HAS NO QUOTA FOR " +
+			args[1] + ".")
+	}
+
+	// Remove minter quota from Blockchain //
+	compositeKey, err := quota.ToCompositeKey(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(compositeKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	quota.Quota = NewAmount(0)
+	quota.Remaining = NewAmount(0)
+	output := Output{UpdateMinterQuotas: map[string]MinterQuota{
+		quota.Minter + " " + quota.Token: quota}}
+	return outputResponse(stub, EVENT_MINTER_QUOTA_UPDATED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+mintItem: This function is called by an admin to mint a new item of a NFT POD token to an address.
+          The item adds a whole token to the balance of the owner and to the supply of the token.
+          Args: array containing a json with:
+Token              string    // Symbol of the NFT POD token
+ItemId             string    // Unique Id of the item in the token
+Owner              string    // Address receiving the item
+MetadataURI        string    // URI of the metadata of the item
+MetadataHash       string    // Hash of the metadata of the item
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) mintItem(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: MINTITEM FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	item := NFTItem{}
+	err := json.Unmarshal([]byte(args[0]), &item)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	if item.ItemId == "" {
+		return shim.Error("ERROR: THE ID OF THE ITEM CANNOT BE EMPTY.")
+	}
+
+	// Get state of the token from the Ledger //
+	token, err := t.getToken(stub, item.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if token.TokenType != NFT_POD_TOKEN {
+		return shim.Error("ERROR: ITEMS CAN ONLY BE MINTED FOR NFT POD TOKENS.")
+	}
+	err = checkTokenStatus(token, TOKEN_ACTIVE)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Check that the item is unique //
+	existing := NFTItem{Token: item.Token, ItemId: item.ItemId}
+	isLoaded, err := existing.LoadState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if isLoaded {
+		return shim.Error("ERROR: THE ITEM " + item.ItemId + " OF " + item.Token +
+			" ALREADY EXISTS.")
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	item.Approved = ""
+	item.Minted = timestamp
+
+	// Credit the owner with the whole token of the item //
+	mint := Transfer{
+		Type: "ItemMint", Token: item.Token, To: item.Owner,
+		Amount: WholeTokens(1, token.Decimals), Id: stub.GetTxID(), Date: timestamp}
+	balance, err := t.checkBalance(stub, item.Owner, item.Token, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	balance.Amount, err = saveAddition(balance.Amount, mint.Amount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	balance.Items++
+	err = t.updateBalance(stub, balance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Mint the token in the system and update state //
+	token.Supply, err = saveAddition(token.Supply, mint.Amount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkMaxSupply(token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = t.updateToken(stub, token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Store the item and its owner //
+	err = saveTokenState(stub, item.Token, &item)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = updateItemOwnerIndex(stub, item, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{
+		UpdateBalances: map[string]Balance{item.Owner + " " + item.Token: balance},
+		UpdateTokens:   map[string]Token{token.Symbol: token},
+		Transactions:   map[string]Transfer{mint.Id: mint},
+		UpdateItems:    map[string]NFTItem{item.Token + " " + item.ItemId: item}}
+	return outputResponse(stub, EVENT_ITEM_MINTED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+transferItem: This function is called to transfer an item of a NFT POD token with the whole token
+              backing it. It is signed by the owner, the address approved for the item or an
+              operator of the owner. Args: array containing
+Token              string    // Symbol of the NFT POD token (args[0])
+ItemId             string    // Id of the item
+From               string    // Owner of the item
+To                 string    // Address receiving the item
+Signer             string    // Owner, approved address or operator signing (defaults to From)
+Id                 string    // ID of the transaction
+Date               int64     // Client date in seconds, replaced by the transaction timestamp
+Nonce              uint64    // Next nonce of the signer (see getNonce)
+Signature          string    // Signature of the item operation digest by the signer (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) transferItem(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: TRANSFERITEM FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+	operation := ItemOperation{}
+	err := json.Unmarshal([]byte(args[0]), &operation)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	if operation.Signer == "" {
+		operation.Signer = operation.From
+	}
+	item, err := getItem(stub, operation.Token, operation.ItemId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	token, err := t.getToken(stub, operation.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Check if transfer is possible //
+	transfer := Transfer{
+		Type: "ItemTransfer", Token: operation.Token, From: operation.From, To: operation.To,
+		Amount: WholeTokens(1, token.Decimals), Id: operation.Id, Date: operation.Date,
+		Nonce: operation.Nonce}
+	if operation.Signer != operation.From {
+		transfer.Spender = operation.Signer
+	}
+	err = t.checkTokenTransferConditions(stub, &transfer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if transfer.From == transfer.To {
+		return shim.Error("ERROR: SENDER AND RECEIVER CANNOT BE THE " +
+			" SAME IN A TRANSFER.")
+	}
+
+	// Validate signature of the signer and consume its nonce //
+	err = checkItemOperation(stub, TRANSFER_ITEM_TYPE, operation, args[1], item)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Reject transfers that were already processed //
+	err = checkTransactionNotProcessed(stub, transfer.Id)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Withdraw the whole token of the item from the owner //
+	senderBalance, err := t.checkBalance(stub, transfer.From, transfer.Token, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if senderBalance.Items <= 0 {
+		return shim.Error("ERROR: THE BALANCE OF " + transfer.From + " HAS NO ITEMS OF " +
+			transfer.Token + ".")
+	}
+	senderBalance.Items--
+	senderBalance, err = withdrawFromBalance(stub, senderBalance, transfer.Amount,
+		NewAmount(0))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Add the whole token of the item to the receiver //
+	receiverBalance, err := t.checkBalance(stub, transfer.To, transfer.Token, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	receiverBalance.Amount, err = saveAddition(receiverBalance.Amount, transfer.Amount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	receiverBalance.Items++
+	balances := map[string]Balance{
+		transfer.From + " " + transfer.Token: senderBalance,
+		transfer.To + " " + transfer.Token:   receiverBalance}
+	err = t.updateBalances(stub, balances)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Move the item to the receiver and clear its approval //
+	item.Owner = transfer.To
+	item.Approved = ""
+	err = item.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = updateItemOwnerIndex(stub, item, transfer.From)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Register transaction as processed //
+	err = recordTransaction(stub, transfer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{
+		UpdateBalances: balances,
+		Transactions:   map[string]Transfer{transfer.Id: transfer},
+		UpdateItems:    map[string]NFTItem{item.Token + " " + item.ItemId: item}}
+	return outputResponse(stub, EVENT_ITEM_TRANSFERRED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+approveItem: This function is called by the owner of an item, or one of its operators, to approve an
+             address to transfer the item. The approval is cleared when the item is transferred.
+             Args: array containing
+Token              string    // Symbol of the NFT POD token (args[0])
+ItemId             string    // Id of the item
+From               string    // Owner of the item
+To                 string    // Address approved for the item (empty to clear the approval)
+Signer             string    // Owner or operator signing (defaults to From)
+Nonce              uint64    // Next nonce of the signer (see getNonce)
+Signature          string    // Signature of the item operation digest by the signer (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) approveItem(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: APPROVEITEM FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+	operation := ItemOperation{}
+	err := json.Unmarshal([]byte(args[0]), &operation)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	if operation.Signer == "" {
+		operation.Signer = operation.From
+	}
+	item, err := getItem(stub, operation.Token, operation.ItemId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if operation.To == item.Owner {
+		return shim.Error("ERROR: THE OWNER OF AN ITEM CANNOT BE APPROVED FOR IT.")
+	}
+
+	// Validate signature of the signer and consume its nonce //
+	err = checkItemOperation(stub, APPROVE_ITEM_TYPE, operation, args[1], item)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Update approval of the item //
+	item.Approved = operation.To
+	err = item.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	output := Output{UpdateItems: map[string]NFTItem{item.Token + " " + item.ItemId: item}}
+	return outputResponse(stub, EVENT_ITEM_APPROVED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+setItemOperator: This function is called by an owner to approve or revoke an operator, which can
+                 transfer and approve all the items of a NFT POD token of the owner. Args: array
+                 containing
+Token              string    // Symbol of the NFT POD token (args[0])
+From               string    // Owner of the items
+To                 string    // Operator
+Approved           bool      // True to approve the operator, false to revoke it
+Nonce              uint64    // Next nonce of the owner (see getNonce)
+Signature          string    // Signature of the item operation digest by the owner (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) setItemOperator(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: SETITEMOPERATOR FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+	operation := ItemOperation{}
+	err := json.Unmarshal([]byte(args[0]), &operation)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	if operation.Signer == "" {
+		operation.Signer = operation.From
+	}
+	if operation.Signer != operation.From {
+		return shim.Error("ERROR: ONLY THE OWNER CAN SET THE OPERATORS OF ITS ITEMS.")
+	}
+	if operation.To == "" || operation.To == operation.From {
+		return shim.Error("ERROR: THE OPERATOR SHOULD BE AN ADDRESS OTHER THAN THE OWNER.")
+	}
+	token, err := t.getToken(stub, operation.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if token.TokenType != NFT_POD_TOKEN {
+		return shim.Error("ERROR: OPERATORS CAN ONLY BE SET FOR NFT POD TOKENS.")
+	}
+
+	// Validate signature of the owner and consume its nonce //
+	err = validateSignature(operation.From,
+		itemOperationDigest(SET_ITEM_OPERATOR_TYPE, operation), args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = useNonce(stub, operation.From, operation.Nonce)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Store or remove the operator //
+	itemOperator := ItemOperator{
+		Owner: operation.From, Token: operation.Token, Operator: operation.To,
+		Approved: operation.Approved}
+	if itemOperator.Approved {
+		err = saveTokenState(stub, itemOperator.Token, &itemOperator)
+	} else {
+		var compositeKey string
+		compositeKey, err = itemOperator.ToCompositeKey(stub)
+		if err == nil {
+			err = stub.DelState(compositeKey)
+		}
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	output := Output{UpdateItemOperators: map[string]ItemOperator{
+		itemOperator.Owner + " " + itemOperator.Token + " " + itemOperator.Operator: itemOperator}}
+	return outputResponse(stub, EVENT_ITEM_OPERATOR_UPDATED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+getItemsOfOwner: this function retrieves a page of the items of a NFT POD token owned by an address
+Token                 string    // Symbol of the token (args[0])
+Owner                 string    // Address of the owner (args[1])
+PageSize              int32     // Number of records of the page (args[2], optional)
+Bookmark              string    // Bookmark returned by the previous page
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) getItemsOfOwner(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("ERROR: GETITEMSOFOWNER FUNCTION SHOULD BE CALLED " +
+			"WITH 2 OR 3 ARGUMENTS.")
+	}
+	pageQuery := PageQuery{}
+	if len(args) == 3 {
+		err := json.Unmarshal([]byte(args[2]), &pageQuery)
+		if err != nil {
+			return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+		}
+	}
+
+	items, page, err := getItemsOfOwnerPage(stub, args[0], args[1], pageQuery)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	page.Records = items
+	pageBytes, _ := json.Marshal(page)
+	return shim.Success(pageBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+distributeDividend: This function is called by an admin to distribute an amount of a payout token to
+                    the holders of a FT POD token, in proportion to their balances. The first call
+                    escrows the amount from the source and pauses the pod token. Every call walks a
+                    batch of holders after the cursor of the dividend, and should be repeated with
+                    the same Id until the dividend is COMPLETED. The batches first sum the balances
+                    of the holders, which are the base of the shares as the supply also counts the
+                    credit and escrow of the pod token, then pay them. Each holder gets its share
+                    rounded down and the rounding remainder is returned to the source at the end.
+                    Payouts are recorded under the dividend, so a holder is never paid twice.
+                    Args: array containing
+Id                 string    // Id of the dividend (args[0])
+PodToken           string    // Symbol of the FT POD token whose holders are paid
+PayoutToken        string    // Symbol of the token paid to the holders
+TotalAmount        string    // Amount to distribute in base units of the payout token
+Source             string    // Address funding the dividend
+PageSize           int32     // Number of holders paid by the call (args[1], optional)
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) distributeDividend(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("ERROR: DISTRIBUTEDIVIDEND FUNCTION SHOULD BE CALLED " +
+			"WITH ONE OR TWO ARGUMENTS.")
+	}
+	input := Dividend{}
+	err := json.Unmarshal([]byte(args[0]), &input)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	if input.Id == "" {
+		return shim.Error("ERROR: THE ID OF THE DIVIDEND CANNOT BE EMPTY.")
+	}
+	err = checkTransactionId(input.Id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	pageQuery := PageQuery{}
+	if len(args) == 2 {
+		err = json.Unmarshal([]byte(args[1]), &pageQuery)
+		if err != nil {
+			return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+		}
+	}
+	if pageQuery.PageSize <= 0 {
+		pageQuery.PageSize = DEFAULT_PAGE_SIZE
+	}
+	if pageQuery.PageSize > MAX_PAGE_SIZE {
+		pageQuery.PageSize = MAX_PAGE_SIZE
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	balances := make(map[string]Balance)
+	transactions := make(map[string]Transfer)
+	tokens := make(map[string]Token)
+
+	// Retrieve the open dividend or open a new one //
+	dividend := Dividend{Id: input.Id}
+	isLoaded, err := dividend.LoadState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if isLoaded && dividend.Status != DIVIDEND_OPEN {
+		return shim.Error("ERROR: THE DIVIDEND " + dividend.Id + " IS ALREADY " +
+			dividend.Status + ".")
+	}
+	if !isLoaded {
+		dividend = input
+
+		// Check the pod token and the payout token //
+		podToken, err := t.getToken(stub, dividend.PodToken)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if podToken.TokenType != FT_POD_TOKEN {
+			return shim.Error("ERROR: DIVIDENDS CAN ONLY BE DISTRIBUTED TO FT POD TOKENS.")
+		}
+		err = checkTokenStatus(podToken, TOKEN_ACTIVE)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if podToken.Supply.Sign() <= 0 {
+			return shim.Error("ERROR: THE POD TOKEN " + podToken.Symbol + " HAS NO SUPPLY.")
+		}
+		if dividend.PayoutToken == dividend.PodToken {
+			return shim.Error("ERROR: THE PAYOUT TOKEN SHOULD BE DIFFERENT FROM THE POD TOKEN.")
+		}
+		payoutToken, err := t.getToken(stub, dividend.PayoutToken)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = checkTokenStatus(payoutToken, TOKEN_ACTIVE)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = dividend.TotalAmount.Resolve(payoutToken.Decimals)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if dividend.TotalAmount.Sign() <= 0 {
+			return shim.Error("ERROR: THE TOTAL AMOUNT OF THE DIVIDEND SHOULD BE POSITIVE.")
+		}
+
+		// Escrow total amount from the source //
+		escrow := Transfer{
+			Type: "DividendEscrow", Token: dividend.PayoutToken, From: dividend.Source,
+			Amount: dividend.TotalAmount, Id: transactionLegId(dividend.Id, "escrow"),
+			Date: timestamp}
+		err = checkTransactionLegNotProcessed(stub, escrow.Id)
+		if err != nil {
+			return errorResponse(err)
+		}
+		sourceBalance, err := t.checkBalance(stub, dividend.Source, dividend.PayoutToken, true)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		sourceBalance, err = withdrawFromBalance(stub, sourceBalance, dividend.TotalAmount,
+			NewAmount(0))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		balances[dividend.Source+" "+dividend.PayoutToken] = sourceBalance
+		transactions[escrow.Id] = escrow
+		err = recordTransaction(stub, escrow)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// Pause the pod token until the dividend completes, freezing the holder balances //
+		dividend.PodSupply = NewAmount(0)
+		dividend.Counted = false
+		dividend.Remaining = dividend.TotalAmount
+		dividend.Paid = 0
+		dividend.Cursor = ""
+		dividend.Status = DIVIDEND_OPEN
+		dividend.Created = timestamp
+		dividend.Completed = 0
+		podToken.Status = TOKEN_PAUSED
+		err = t.updateToken(stub, podToken)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		tokens[podToken.Symbol] = podToken
+	}
+
+	// Walk a batch of holders after the cursor //
+	holderList, hasMore, err := getTokenHoldersAfter(stub, dividend.PodToken, dividend.Cursor,
+		int(pageQuery.PageSize))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	podBalances, err := loadHolderBalances(stub, dividend.PodToken, holderList)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Sum the balances of the holders before paying them //
+	if !dividend.Counted {
+		for _, podBalance := range podBalances {
+			dividend.Cursor = podBalance.Address
+			dividend.PodSupply = dividend.PodSupply.Add(podBalance.Amount)
+		}
+		if !hasMore {
+			dividend.Counted = true
+			dividend.Cursor = ""
+			hasMore = true // the holders are paid from the next call //
+		}
+		podBalances = []Balance{}
+	}
+
+	// Pay the holders of the batch //
+	for _, podBalance := range podBalances {
+		dividend.Cursor = podBalance.Address
+		dividend.Paid++
+		payout := dividend.TotalAmount.MulRatio(podBalance.Amount, dividend.PodSupply)
+		payout = MinAmount(payout, dividend.Remaining)
+		if payout.Sign() <= 0 {
+			continue
+		}
+		transfer := Transfer{
+			Type: "Dividend", Token: dividend.PayoutToken, From: dividend.Source,
+			To: podBalance.Address, Amount: payout, Id: transactionLegId(dividend.Id, podBalance.Address),
+			Date: timestamp}
+		err = recordDividendPayout(stub, dividend, transfer)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		err = t.payDividend(stub, transfer, balances)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		dividend.Remaining = dividend.Remaining.Sub(payout)
+		transactions[transfer.Id] = transfer
+	}
+
+	// Return the rounding remainder to the source and resume the pod token //
+	if !hasMore {
+		if dividend.Remaining.Sign() > 0 {
+			transfer := Transfer{
+				Type: "DividendRemainder", Token: dividend.PayoutToken, From: dividend.Source,
+				To: dividend.Source, Amount: dividend.Remaining, Id: transactionLegId(dividend.Id, "remainder"),
+				Date: timestamp}
+			err = t.payDividend(stub, transfer, balances)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			transactions[transfer.Id] = transfer
+		}
+		dividend.Remaining = NewAmount(0)
+		dividend.Status = DIVIDEND_COMPLETED
+		dividend.Completed = timestamp
+		podToken, err := t.getToken(stub, dividend.PodToken)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if podToken.Status == TOKEN_PAUSED {
+			podToken.Status = TOKEN_ACTIVE
+			err = t.updateToken(stub, podToken)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		tokens[podToken.Symbol] = podToken
+	}
+
+	// Update balances and dividend //
+	err = t.updateBalances(stub, balances)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = saveDividend(stub, dividend)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{
+		UpdateBalances:  balances,
+		UpdateTokens:    tokens,
+		Transactions:    transactions,
+		UpdateDividends: map[string]Dividend{dividend.Id: dividend}}
+	return outputResponse(stub, EVENT_DIVIDEND_DISTRIBUTED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+cancelDividend: This function is called by an admin to cancel an OPEN dividend that cannot be
+                completed. The amount left in escrow is refunded to the source and the pod token is
+                resumed. The holders already paid keep their payouts. Args: array containing
+Id                 string    // Id of the dividend (args[0])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) cancelDividend(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve the open dividend //
+	if err := checkArgs(args, 1, "cancelDividend"); err != nil {
+		return shim.Error(err.Error())
+	}
+	dividend := Dividend{Id: args[0]}
+	isLoaded, err := dividend.LoadState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isLoaded {
+		return shim.Error("ERROR: THE DIVIDEND " + args[0] + " DOES NOT EXIST.")
+	}
+	if dividend.Status != DIVIDEND_OPEN {
+		return shim.Error("ERROR: THE DIVIDEND " + dividend.Id + " IS ALREADY " +
+			dividend.Status + ".")
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	balances := make(map[string]Balance)
+	transactions := make(map[string]Transfer)
+	tokens := make(map[string]Token)
+
+	// Refund the escrow to the source //
+	if dividend.Remaining.Sign() > 0 {
+		transfer := Transfer{
+			Type: "DividendRefund", Token: dividend.PayoutToken, From: dividend.Source,
+			To: dividend.Source, Amount: dividend.Remaining, Id: transactionLegId(dividend.Id, "refund"),
+			Date: timestamp}
+		err = t.payDividend(stub, transfer, balances)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		transactions[transfer.Id] = transfer
+	}
+	dividend.Remaining = NewAmount(0)
+	dividend.Status = DIVIDEND_CANCELLED
+	dividend.Completed = timestamp
+
+	// Resume the pod token //
+	podToken, err := t.getToken(stub, dividend.PodToken)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if podToken.Status == TOKEN_PAUSED {
+		podToken.Status = TOKEN_ACTIVE
+		err = t.updateToken(stub, podToken)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	tokens[podToken.Symbol] = podToken
+
+	// Update balances and dividend //
+	err = t.updateBalances(stub, balances)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = saveDividend(stub, dividend)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{
+		UpdateBalances:  balances,
+		UpdateTokens:    tokens,
+		Transactions:    transactions,
+		UpdateDividends: map[string]Dividend{dividend.Id: dividend}}
+	return outputResponse(stub, EVENT_DIVIDEND_CANCELLED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+propose: This function is called by an approver of the governance to propose an action, which is
+         approved by the proposer. The Id of the proposal is the TxID of the call.
+Action             string    // Governed function or updateGovernance (args[0])
+Payload            string    // Json array with the arguments of the action (args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) propose(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: PROPOSE FUNCTION SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+	if !stringInSlice(args[0], governedFunctions) && args[0] != UPDATE_GOVERNANCE_ACTION {
+		return shim.Error("ERROR: THE ACTION " + args[0] + " CANNOT BE PROPOSED.")
+	}
+	payload := []string{}
+	err := json.Unmarshal([]byte(args[1]), &payload)
+	if err != nil {
+		return shim.Error("ERROR: THE PAYLOAD SHOULD BE A JSON ARRAY OF ARGUMENTS. " +
+			err.Error())
+	}
+	governance, identity, err := getApprover(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Register proposal approved by the proposer //
+	proposal := Proposal{
+		Id: stub.GetTxID(), Action: args[0], Payload: payload, Proposer: identity,
+		Approvals: map[string]int64{identity: timestamp}, Status: PROPOSAL_PENDING,
+		Created: timestamp, Expiry: timestamp + governance.ProposalLifetime}
+	err = proposal.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{UpdateProposals: map[string]Proposal{proposal.Id: proposal}}
+	return outputResponse(stub, EVENT_PROPOSAL_UPDATED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+approveProposal: This function is called by an approver of the governance to approve a pending
+                 proposal before its expiry.
+ProposalId         string    // Id of the proposal (args[0])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) approveProposal(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: APPROVEPROPOSAL FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	_, identity, err := getApprover(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	proposal, err := getPendingProposal(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, approved := proposal.Approvals[identity]; approved {
+		return shim.Error("ERROR: THE PROPOSAL " + proposal.Id + " IS ALREADY APPROVED " +
+			"BY " + identity)
+	}
+
+	// Record approval of the approver //
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	proposal.Approvals[identity] = timestamp
+	err = proposal.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Prepare output object with updates //
+	output := Output{UpdateProposals: map[string]Proposal{proposal.Id: proposal}}
+	return outputResponse(stub, EVENT_PROPOSAL_UPDATED, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+executeProposal: This function is called by an approver of the governance to execute a pending
+                 proposal approved by the threshold of current approvers. The action runs the same code
+                 path as its function and the response of the action is returned.
+ProposalId         string    // Id of the proposal (args[0])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) executeProposal(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: EXECUTEPROPOSAL FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	governance, _, err := getApprover(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	proposal, err := getPendingProposal(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Count approvals of the current approvers //
+	approvals := 0
+	for approver := range proposal.Approvals {
+		if stringInSlice(approver, governance.Approvers) {
+			approvals++
+		}
+	}
+	if approvals < governance.Threshold {
+		return shim.Error(fmt.Sprintf("ERROR: THE PROPOSAL %s HAS %d OF THE %d "+
+			"APPROVALS NEEDED.", proposal.Id, approvals, governance.Threshold))
+	}
+
+	// Mark proposal as executed and run its action //
+	proposal.Status = PROPOSAL_EXECUTED
+	proposal.ExecutedTxId = stub.GetTxID()
+	err = proposal.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	switch proposal.Action {
+	case "mint":
+		return t.mint(stub, proposal.Payload, true)
+	case "multiMint":
+		return t.multiMint(stub, proposal.Payload)
+	case "registerToken":
+		return t.registerToken(stub, proposal.Payload, false)
+	case "reuseTokenSymbol":
+		return t.registerToken(stub, proposal.Payload, true)
+	case "updateTokenInfo":
+		return t.updateTokenInfo(stub, proposal.Payload)
+	case "mintItem":
+		return t.mintItem(stub, proposal.Payload)
+	case UPDATE_GOVERNANCE_ACTION:
+		return t.updateGovernance(stub, proposal.Payload)
+	}
+	return shim.Error("ERROR: UNKNOWN ACTION " + proposal.Action + " OF THE PROPOSAL.")
+}
+
+/* -------------------------------------------------------------------------------------------------
+updateGovernance: this function replaces the approvers and threshold of the governance. It is only
+                  run by the execution of a proposal. Args: array containing a json with:
+Approvers          []string  // Identities of the approvers as MSPID::ID
+Threshold          int       // Number of approvals needed to execute a proposal
+ProposalLifetime   int64     // Seconds before a proposal expires
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) updateGovernance(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: UPDATEGOVERNANCE SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	governance := Governance{}
+	err := json.Unmarshal([]byte(args[0]), &governance)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	err = saveGovernance(stub, governance)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	governanceBytes, _ := json.Marshal(governance)
+	return shim.Success(governanceBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+setAccessRule: This function is called by an admin to set the access rule of a function. The rules
+               of the functions managing the access rules should always allow the admins.
+               Args: array containing a json with:
+Function           string              // Name of the function
+Roles              []string            // Roles allowed to call the function (empty for any role)
+MSPs               []string            // MSPs allowed to call the function (empty for any MSP)
+Attributes         map[string]string   // Attribute values required to the caller ("*" for any)
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) setAccessRule(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: SETACCESSRULE FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	rule := AccessRule{}
+	err := json.Unmarshal([]byte(args[0]), &rule)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	if rule.Function == "" {
+		return shim.Error("ERROR: THE FUNCTION OF THE ACCESS RULE CANNOT BE EMPTY.")
+	}
+	if stringInSlice(rule.Function, aclFunctions) && !stringInSlice(ADMIN_ROLE, rule.Roles) {
+		return shim.Error("ERROR: THE ACCESS RULE OF " + rule.Function + " SHOULD " +
+			"ALLOW THE " + ADMIN_ROLE + " ROLE.")
+	}
+	if stringInSlice(rule.Function, adminOnlyFunctions) &&
+		(len(rule.Roles) != 1 || rule.Roles[0] != ADMIN_ROLE) {
+		return shim.Error("ERROR: THE ACCESS RULE OF " + rule.Function + " SHOULD ONLY " +
+			"ALLOW THE " + ADMIN_ROLE + " ROLE.")
+	}
+
+	err = rule.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ruleBytes, _ := json.Marshal(rule)
+	return shim.Success(ruleBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+removeAccessRule: This function is called by an admin to remove the access rule of a function, which
+                  cannot be called anymore until a rule is set again.
+Function           string    // Name of the function (args[0])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) removeAccessRule(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: REMOVEACCESSRULE FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	if stringInSlice(args[0], aclFunctions) {
+		return shim.Error("ERROR: THE ACCESS RULE OF " + args[0] + " CANNOT BE REMOVED.")
+	}
+	rule := AccessRule{Function: args[0]}
+	compositeKey, err := rule.ToCompositeKey(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(compositeKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/* -------------------------------------------------------------------------------------------------
+getHistory: This function returns a page of the changes of the balance of an address for a token,
+            with the TxID, timestamp, previous and new amount of each change.
+            Args: is an array containing a json with the following attributes:
+Address            string   // Address of the balance
+Token              string   // Symbol of the token
+FromTimestamp      int64    // Timestamp from which retrieve the history
+ToTimestamp        int64    // Timestamp until which retrieve the history (0 for no limit)
+PageSize           int      // Number of changes of the page
+Bookmark           string   // Bookmark returned by the previous page (empty for the first one)
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) getHistory(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: GETHISTORY FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	history := History{}
+	err := json.Unmarshal([]byte(args[0]), &history)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	if history.PageSize <= 0 {
+		history.PageSize = DEFAULT_PAGE_SIZE
+	}
+	if history.PageSize > MAX_PAGE_SIZE {
+		history.PageSize = MAX_PAGE_SIZE
+	}
+
+	// Retrieve page of the history of the balance //
+	page, err := getBalanceHistory(stub, history)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	pageBytes, _ := json.Marshal(page)
+	return shim.Success(pageBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+mint: This function is called to perform a swapping of user's token wallets by the same amount of
+	     Fabric tokens version. It mints new tokens and transfer it to the user balance.
+		 Args: is an array containing a json with the following attributes
+Type               string   // Type of mint
+Token              string   // Symbol of the token to swap
+From               string   // From minting (Ethereum, Pod..)
+To                 string   // Id of the receiver of the tokens
+Amount             string   // Amount of tokens to mint in base units
+Id                 string   // ID of the transaction
+Date               int64    // Client date in seconds, replaced by the transaction timestamp
+Vesting            string   // Optional vesting schedule json of the minted tokens (args[1])
+Minters draw the amount from their quota of the token. Other callers should satisfy the access rule
+of mintWithoutQuota and can only mint directly while the governance is not set, otherwise mint is
+run through a proposal.
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) mint(stub shim.ChaincodeStubInterface,
+	args []string, proposed bool) pb.Response {
+	// Retrieve information from the input //
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("ERROR: MINT FUNCTION SHOULD BE CALLED " +
+			"WITH ONE OR TWO ARGUMENTS.")
+	}
+	input := Transfer{}
+	json.Unmarshal([]byte(args[0]), &input)
+	transactions := make(map[string]Transfer)
+	balances := make(map[string]Balance)
+
+	// Get state of the token from the Ledger //
+	token, err := t.getToken(stub, input.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = input.Amount.Resolve(token.Decimals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkTokenStatus(token, TOKEN_ACTIVE)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if input.Amount.Sign() < 0 {
+		return shim.Error("ERROR: THE AMOUNT TO MINT CANNOT BE NEGATIVE.")
+	}
+
+	// Draw the quota of the minter, other callers are checked out of the governance //
+	quotas := make(map[string]MinterQuota)
+	if !proposed {
+		quota, isMinter, err := drawMinterQuota(stub, input.Token, input.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if isMinter {
+			quotas[quota.Minter+" "+quota.Token] = quota
+		} else {
+			err = checkAccess(stub, "mintWithoutQuota")
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			err = checkGovernanceNotSet(stub, "mint")
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	}
+
+	// Date operation with the transaction timestamp //
+	err = stampTransferDate(stub, &input)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Reject operations that were already processed //
+	err = checkTransactionNotProcessed(stub, input.Id)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Retrieve user balance //
+	userBalance, err2 := t.checkBalance(stub, input.To, input.Token, true)
+	if err2 != nil {
+		return shim.Error(err2.Error())
+	}
+
+	// Transfer swapping amount to user //
+	userBalance.Amount, err = saveAddition(userBalance.Amount, input.Amount)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	receiverBalance, err2 := t.checkBalance(stub, transfer.To, transfer.Token,
-		check)
-	if err2 != nil {
-		return shim.Error(err2.Error())
+
+	// Lock minted amount under a vesting schedule //
+	if len(args) == 2 {
+		schedule := VestingSchedule{}
+		err = json.Unmarshal([]byte(args[1]), &schedule)
+		if err != nil {
+			return shim.Error("ERROR: GETTING THE VESTING SCHEDULE. " + err.Error())
+		}
+		err = createVestingSchedule(stub, schedule, &userBalance, input.Amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 	}
+	balances[input.To+" "+input.Token] = userBalance
+	transactions[input.Id] = input
 
-	// Transfer funds  //
-	senderBalance.Amount, receiverBalance.Amount, err = t.transferHelper(
-		stub, senderBalance.Amount, receiverBalance.Amount, transfer.Amount)
+	// Update user balance //
+	err = t.updateBalance(stub, userBalance)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	transfer.Type = "Transfer"
-	transactions[transfer.Id] = transfer
 
-	// Update balances of sender and receiver //
-	err = t.updateBalance(stub, senderBalance)
+	// Mint amount of tokens in the system and update state //
+	token.Supply, err = saveAddition(token.Supply, input.Amount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkMaxSupply(token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = t.updateToken(stub, token)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	balances[transfer.From+" "+transfer.Token] = senderBalance
+	updateTokens := make(map[string]Token)
+	updateTokens[token.Symbol] = token
 
-	err = t.updateBalance(stub, receiverBalance)
+	// Register transaction as processed //
+	err = recordTransaction(stub, input)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	balances[transfer.From+" "+transfer.Token] = receiverBalance
 
 	// Prepare output object with updates //
-	return generateOutput(balances, nil, transactions)
+	output := Output{UpdateBalances: balances, UpdateTokens: updateTokens,
+		Transactions: transactions, UpdateMinterQuotas: quotas}
+	return outputResponse(stub, EVENT_TOKEN_MINTED, output)
+
 }
 
 /* -------------------------------------------------------------------------------------------------
-multitransfer: This function is called to perform a multitransfer between different actors in
-               one call to blockchain. Args: is a list of transfer types.
+multiMint: This function is called to perform a minting of a particular token to a
+           given list of addresses. Every recipient gets a Transfer with Id TxnId_Address and the
+           supply of the token is increased once by the total amount. The FromAddress cannot be
+           one of the recipients.
+Token           string                     // Token to be minted
+FromAddress     string                     // Address from with the minting is generated
+Type            string                     // Type of transaction
+TxnId           string                     // Id of the transactions
+Date            int64                      // Client date in seconds, replaced by the tx timestamp
+TotalAmount     string                     // Total Amount to mint in base units
+Transfers       map[string]string          // Amount to mint in base units to each address
 ------------------------------------------------------------------------------------------------- */
 
-func (t *CoinBalanceSmartContract) multitransfer(stub shim.ChaincodeStubInterface,
+func (t *CoinBalanceSmartContract) multiMint(stub shim.ChaincodeStubInterface,
 	args []string) pb.Response {
 
-	// Set of users participating in transfer and whose state should be updated //
-	transactions := make(map[string]Transfer)
-	balances := make(map[string]Balance)
-	var err error
-	var senderBalance Balance
-	var receiverBalance Balance
-	var inList bool
-	var check bool
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: MULTIMINT FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	input := MultiMinter{}
+	err := json.Unmarshal([]byte(args[0]), &input)
+	if err != nil {
+		return shim.Error("ERROR: GETTING THE MULTIMINT INPUT. " + err.Error())
+	}
+	if input.TxnId == "" {
+		return shim.Error("ERROR: THE TRANSACTION ID CANNOT BE EMPTY.")
+	}
+	err = checkTransactionId(input.TxnId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(input.Transfers) == 0 {
+		return shim.Error("ERROR: MULTIMINT SHOULD HAVE AT LEAST ONE TRANSFER.")
+	}
+	if len(input.Transfers) > MAX_PAGE_SIZE {
+		return shim.Error(fmt.Sprintf("ERROR: MULTIMINT CANNOT HAVE MORE THAN %d "+
+			"TRANSFERS.", MAX_PAGE_SIZE))
+	}
 
-	// Iterate throught all the transactions on the multitransfer call //
-	for _, arg := range args {
+	// Get state of the token from the Ledger //
+	token, err := t.getToken(stub, input.Token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkTokenStatus(token, TOKEN_ACTIVE)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = input.TotalAmount.Resolve(token.Decimals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-		// Retrieve trasnfer from the list //
-		transfer := Transfer{}
-		json.Unmarshal([]byte(arg), &transfer)
-		if transfer.From == transfer.To || transfer.Amount == 0 {
-			continue
-		}
+	// Date operation with the transaction timestamp //
+	transfer := Transfer{
+		Type: input.Type, Token: input.Token, From: input.FromAddress,
+		Date: input.Date}
+	err = stampTransferDate(stub, &transfer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Iterate the recipients in a deterministic order //
+	addresses := make([]string, 0, len(input.Transfers))
+	for addressTo := range input.Transfers {
+		addresses = append(addresses, addressTo)
+	}
+	sort.Strings(addresses)
 
-		// Check if transfer is allowed //
-		err = t.checkTokenTransferConditions(stub, transfer.Token,
-			transfer.Date, transfer.Amount)
+	transactions := make(map[string]Transfer)
+	balances := make(map[string]Balance)
+	totalAmount := NewAmount(0)
+	for _, addressTo := range addresses {
+		amount := input.Transfers[addressTo]
+		err = amount.Resolve(token.Decimals)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-
-		// Check if sender is already in transaction users list //
-		senderBalance, inList = balances[transfer.From+" "+transfer.Token]
-		if !inList {
-			check = true
-			if transfer.AvoidCheckFrom {
-				check = false
-			}
-			senderBalance, err = t.checkBalance(stub, transfer.From, transfer.Token, check)
-			if err != nil {
-				return shim.Error(err.Error())
-			}
+		if amount.Sign() < 0 {
+			return shim.Error("ERROR: AMOUNT MINTED TO " + addressTo +
+				" CANNOT BE NEGATIVE.")
+		}
+		if input.FromAddress == addressTo {
+			return shim.Error("ERROR: THE ADDRESS " + addressTo + " MINTING THE TOKENS " +
+				"CANNOT BE ONE OF THE RECIPIENTS.")
+		}
+		totalAmount = totalAmount.Add(amount)
+		if amount.IsZero() {
+			continue
 		}
 
-		// Check if receiver is already in transaction users list //
-		receiverBalance, inList = balances[transfer.To+" "+transfer.Token]
-		if !inList {
-			check = true
-			if transfer.AvoidCheckTo {
-				check = false
-			}
-			receiverBalance, err = t.checkBalance(stub, transfer.To, transfer.Token, check)
-			if err != nil {
-				return shim.Error(err.Error())
-			}
+		// Reject recipients that were already processed //
+		transfer.To = addressTo
+		transfer.Amount = amount
+		transfer.Id = transactionLegId(input.TxnId, addressTo)
+		err = checkTransactionLegNotProcessed(stub, transfer.Id)
+		if err != nil {
+			return errorResponse(err)
 		}
 
-		// Check that the sender holds the amount to send and transfer funds //
-		senderBalance.Amount, receiverBalance.Amount, err = t.transferHelper(
-			stub, senderBalance.Amount, receiverBalance.Amount, transfer.Amount)
+		// Credit receiver balance //
+		receiverBalance, err := t.checkBalance(stub, addressTo, input.Token, true)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-
-		// Update balances //
-		balances[transfer.From+" "+transfer.Token] = senderBalance
-		balances[transfer.To+" "+transfer.Token] = receiverBalance
+		receiverBalance.Amount, err = saveAddition(receiverBalance.Amount, amount)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		balances[addressTo+" "+input.Token] = receiverBalance
 		transactions[transfer.Id] = transfer
 	}
 
+	// Check that all the desired amount is minted to the users //
+	if totalAmount.Cmp(input.TotalAmount) != 0 {
+		return shim.Error("ERROR: TOTAL AMOUNT MINTED TO USERS " + totalAmount.String() +
+			" SHOULD BE EQUAL TO THE TOTAL AMOUNT DESIRED TO MINT " +
+			input.TotalAmount.String() + ".")
+	}
+
 	// Update States of all the users that did some transaction //
-	for _, balance := range balances {
+	for _, address := range addresses {
+		balance, inList := balances[address+" "+input.Token]
+		if !inList {
+			continue
+		}
 		err = t.updateBalance(stub, balance)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
+		err = recordTransaction(stub, transactions[transactionLegId(input.TxnId, address)])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 	}
 
-	// Prepare output object with updates //
-	return generateOutput(balances, nil, transactions)
-}
-
-// /* -------------------------------------------------------------------------------------------------
-// spendFunds: This function is called when a user wants to spend funds with some tokens. This function
-// 			should be called with the following arguments:
-// PublicId           string      // ID of the fund spender
-// ProviderId         string      // ID of the provider
-// Token              string      // Symbol of token to transfer
-// Amount             float64     // Amount desired to spend
-// ------------------------------------------------------------------------------------------------- */
-
-// func (t *CoinBalanceSmartContract) spendFunds( stub shim.ChaincodeStubInterface,
-// 										       args []string ) pb.Response {
-// 	//// Retrieve information from the input //
-// 	if len(args) != 1 {
-// 		return shim.Error( "ERROR: GETHISTORY FUNCTION SHOULD BE CALLED " +
-// 						   "WITH ONE ARGUMENT." ) }
-// 	spending := Spending{}
-// 	json.Unmarshal([]byte(args[0]), &spending)
-
-// 	// Retrieve mutiwallet of spender //
-// 	walletBytes, err1 := stub.GetState( IndexWallet + spending.PublicId )
-// 	if err1 != nil {
-// 		return shim.Error( "ERROR: RETRIEVING MULTIWALLET FOR USER: " + spending.PublicId +
-// 						   ". " + err1.Error() ) }
-// 	spender_wallet := MultiWallet{}
-// 	json.Unmarshal(walletBytes, &spender_wallet)
-// 	spender_balance := spender_wallet.Balances[spending.Token]
-
-// 	// Retrieve mutiwallet of provider //
-// 	walletBytes2, err2 := stub.GetState( IndexWallet + spending.ProviderId )
-// 	if err2 != nil {
-// 		return shim.Error( "ERROR: RETRIEVING MULTIWALLET FOR USER: " + spending.ProviderId +
-// 						   ". " + err2.Error() ) }
-// 	provider_wallet := MultiWallet{}
-// 	json.Unmarshal(walletBytes2, &provider_wallet)
-// 	provider_balance := provider_wallet.Balances[spending.Token]
-
-// 	// Get all PRIVI Loans of user //
-// 	PRIVI_credits := []PRIVIloan{}
-// 	total_credit := 0.
-// 	total_credit_discount := 0.
-// 	for priviId, _ := range(spender_balance.PRIVIcreditBorrow) {
-// 		privi_loan := PRIVIloan{}
-// 		chainCodeArgs := util.ToChaincodeArgs( "getPRIVIcredit", priviId )
-// 		response := stub.InvokeChaincode( PRIVI_CREDIT_CHAINCODE, chainCodeArgs,
-// 											CHANNEL_NAME )
-// 		if response.Status != shim.OK {
-// 			return shim.Error( "ERROR INVOKING THE PRIVICREDIT CHAINCODE TO " +
-// 								"GET THE PRIVI CREDIT INFO OF: " + priviId ) }
-// 		json.Unmarshal(response.Payload, &privi_loan)
-// 		PRIVI_credits = append( PRIVI_credits, privi_loan )
-// 		borrower_credit := privi_loan.State.Borrowers[ spending.PublicId ]
-// 		total_credit = total_credit + borrower_credit.Amount
-// 		total_credit_discount = total_credit_discount +
-// 		                        borrower_credit.Amount * (1-privi_loan.P_premium) }
-
-// 	transactions := []Transfer{}
-// 	PREMIUMS := map[string]Premium{}
-// 	// Check if user needs to user PRIVI Credit Funds //
-// 	amount_without_credit := math.Max(spender_balance.Amount - total_credit, 0.)
-// 	if spending.Amount > amount_without_credit {
-// 		if amount_without_credit + total_credit_discount < spending.Amount {
-// 			return shim.Error( "ERROR: THE SPENDER " + spending.PublicId + " DOES NOT HAVE " +
-// 							   "ENOUGH FUNDS TO SPEND.") }
-// 		// Charge first the amount without credit //
-// 		transfer := Transfer{
-// 			Type: "spending", Token: spending.Token, From: spending.PublicId,
-// 			To: spending.ProviderId, Amount: amount_without_credit }
-// 		transactions = append( transactions, transfer )
-// 		// Credit needed to pay remaining //
-// 		credit_needed := spending.Amount - amount_without_credit
-// 		for i, priviLoan := range(PRIVI_credits) {
-// 			if credit_needed <= 0. {break;}
-// 			spender_PRIVI, _ := priviLoan.State.Borrowers[ spending.PublicId ]
-// 			// Check if it is enough with this credit //
-// 			premium_charged := credit_needed * priviLoan.P_premium
-// 			amount_charged := credit_needed + premium_charged
-// 			if spender_PRIVI.Amount < amount_charged {
-// 				premium_charged = spender_PRIVI.Amount * priviLoan.P_premium
-// 				amount_charged = spender_PRIVI.Amount
-// 			}
-// 			credit_needed = credit_needed - (amount_charged-premium_charged)
-// 			transfer_premium := Transfer{
-// 				Type: "PRIVI_premium", Token: spending.Token, From: spending.PublicId,
-// 				To: "PRIVI Pool " + priviLoan.LoanId, Amount: premium_charged }
-// 			transactions = append( transactions, transfer_premium )
-// 			// Update PRIVI Loan with new information //
-// 			premium_list := priviLoan.State.PremiumList
-// 			premium_id := xid.New().String()
-// 			premium_list[premium_id] = Premium{ ProviderId: spending.ProviderId,
-// 				PremiumId: premium_id, Risk_Pct: 0., Premium_Amount: premium_charged }
-// 			//new_premium, _ := json.Marshal(premium_list[premium_id])
-// 			PREMIUMS[priviLoan.LoanId] = premium_list[premium_id]
-// 			spender_PRIVI.Amount = spender_PRIVI.Amount - amount_charged
-// 			spender_balance.Amount = spender_balance.Amount - premium_charged
-// 			priviLoan.State.Total_Premium = priviLoan.State.Total_Premium + premium_charged
-// 			priviLoan.State.Total_Coverage = priviLoan.State.Total_Coverage + premium_charged
-// 			priviLoan.State.PremiumList = premium_list
-// 			priviLoan.State.Borrowers[ spending.PublicId ] = spender_PRIVI
-// 			PRIVI_credits[i] = priviLoan }
-// 	}
-
-// 	// Transfer funds from spender to provider //
-// 	spender_balance.Amount = spender_balance.Amount - spending.Amount
-// 	provider_balance.Amount = provider_balance.Amount + spending.Amount
-// 	transfer := Transfer{
-// 		Type: "spending", Token: spending.Token, From: spending.PublicId,
-// 		To: spending.ProviderId, Amount: spending.Amount }
-// 	transactions = append( transactions, transfer )
-
-// 	// Update state of wallet for both Spender on Blockchain //
-// 	spender_wallet.Balances[spending.Token] = spender_balance
-// 	spender_wallet.Transaction = transactions
-// 	spenderAsBytes, _ := json.Marshal(spender_wallet)
-// 	err3 := stub.PutState(IndexWallet + spending.PublicId, spenderAsBytes)
-// 	if err3 != nil {
-// 		return shim.Error( "ERROR: STORING SPENDER ON BLOCKCHAIN " + err3.Error() ) }
-
-// 	// Update state of wallet for both Provider on Blockchain //
-// 	provider_wallet.Balances[spending.Token] = provider_balance
-// 	provider_wallet.Transaction = transactions
-// 	providerAsBytes, _ := json.Marshal(provider_wallet)
-// 	err4 := stub.PutState(IndexWallet + spending.ProviderId, providerAsBytes)
-// 	if err4 != nil {
-// 		return shim.Error( "ERROR: STORING PROVIDER ON BLOCKCHAIN " + err4.Error() ) }
-
-// 	// Update PRIVI credits of user by invoking PRIVI Coin Chaincode //
-// 	update_privi_credits := []string{"updatePRIVIcredits"}
-// 	for _, credit := range(PRIVI_credits) {
-// 		creditBytes, _ := json.Marshal( credit )
-// 		update_privi_credits = append( update_privi_credits, string(creditBytes)) }
-// 	multiChainCodeArgs := ToChaincodeArgs( update_privi_credits )
-// 	response2 := stub.InvokeChaincode( PRIVI_CREDIT_CHAINCODE, multiChainCodeArgs,
-// 										CHANNEL_NAME )
-// 	if response2.Status != shim.OK {
-// 		return shim.Error( "ERROR INVOKING THE UPDATEMULTIWALLET CHAINCODE TO " +
-// 							"UPDATE THE WALLET OF USERs" )
-// 	}
-// 	premiumsBytes, _ := json.Marshal(PREMIUMS)
-// 	return shim.Success(premiumsBytes)
-// }
-
-// /* -------------------------------------------------------------------------------------------------
-// getHistory: This function returns the transaction history of a given Public Key Id from a given
-//             timestamp. Args: is an array containing a json with the following attributes:
-// PublicId           string   // Id of the user to retrieve the history
-// Timestamp          string   // Timestamp of time from which retrieve the history
-// ------------------------------------------------------------------------------------------------- */
-
-// func (t *CoinBalanceSmartContract) getHistory( stub shim.ChaincodeStubInterface,
-// 	                                           args []string ) pb.Response {
-
-// 	// Retrieve information from the input //
-// 	if len(args) != 1 {
-// 		return shim.Error( "ERROR: GETHISTORY FUNCTION SHOULD BE CALLED " +
-// 						   "WITH ONE ARGUMENT." )
-// 	}
-// 	history := History{}
-// 	input := []byte(args[0])
-// 	json.Unmarshal(input, &history)
-
-// 	// Retrieve iterator of History for the User Public Key //
-// 	resultsIterator, err1 := stub.GetHistoryForKey(IndexWallet + history.PublicId)
-// 	if err1 != nil {
-// 		return shim.Error( "ERROR: RETRIEVING THE HISTORY FROM BLOCKCHAIN. " +
-// 						   "ERROR WAS: " + err1.Error())
-// 	}
-// 	defer resultsIterator.Close()
-
-// 	// Create response. Filter for timestamps greater than the given one //
-// 	var buffer bytes.Buffer
-// 	buffer.WriteString("[")
-// 	bArrayMemberAlreadyWritten := false
-// 	for resultsIterator.HasNext() {
-// 		response, err2 := resultsIterator.Next()
-// 		if err2 != nil {
-// 			return shim.Error( "ERROR: GETTING NEXT ITERATOR. " +
-// 						       "ERROR WAS: " + err2.Error())
-// 		}
-// 		//Check if txn time is greater than the query time //
-// 		time_txn :=time.Unix( response.Timestamp.Seconds,
-// 			                  int64(response.Timestamp.Nanos))
-// 		if ( time_txn.Unix() < history.Timestamp ||
-// 		     response.IsDelete) {continue;}
-
-// 		// Add a comma before array members, suppress it for first one
-// 		if bArrayMemberAlreadyWritten == true {buffer.WriteString(",")}
-// 		buffer.WriteString("{\"TxId\":")
-// 		buffer.WriteString("\"")
-// 		buffer.WriteString(response.TxId)
-// 		buffer.WriteString("\"")
-
-// 		data := make(map[string]interface{})
-// 		json.Unmarshal(response.Value, &data)
-// 		buffer.WriteString(", \"Value\":")
-// 		dataAsBytes, _ := json.Marshal(data["Transaction"])
-// 		buffer.WriteString(string(dataAsBytes))
-
-// 		buffer.WriteString(", \"Timestamp\":")
-// 		buffer.WriteString("\"")
-// 		buffer.WriteString( strconv.FormatInt(time_txn.Unix(),10) )
-// 		buffer.WriteString("\"")
-// 		buffer.WriteString("}")
-// 		bArrayMemberAlreadyWritten = true
-// 	}
-// 	buffer.WriteString("]")
-
-// 	return shim.Success(buffer.Bytes())
-// }
-
-/* -------------------------------------------------------------------------------------------------
-mint: This function is called to perform a swapping of user's token wallets by the same amount of
-	     Fabric tokens version. It mints new tokens and transfer it to the user balance.
-		 Args: is an array containing a json with the following attributes
-Type               string   // Type of mint
-Token              string   // Symbol of the token to swap
-From               string   // From minting (Ethereum, Pod..)
-To                 string   // Id of the receiver of the tokens
-Amount             float64  // Amount of tokens to mint
-Id                 string   // ID of the transaction
-Date               float64  // Date timestamp
-------------------------------------------------------------------------------------------------- */
-
-func (t *CoinBalanceSmartContract) mint(stub shim.ChaincodeStubInterface,
-	args []string) pb.Response {
-	// Retrieve information from the input //
-	if len(args) != 1 {
-		return shim.Error("ERROR: MINT FUNCTION SHOULD BE CALLED " +
-			"WITH ONE ARGUMENT.")
-	}
-	input := Transfer{}
-	json.Unmarshal([]byte(args[0]), &input)
-	transactions := make(map[string]Transfer)
-	balances := make(map[string]Balance)
-
-	// Get state of the token from the Ledger //
-	token, err := t.getToken(stub, input.Token)
+	// Mint amount of tokens in the system and update state //
+	token.Supply, err = saveAddition(token.Supply, totalAmount)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-	// Retrieve user balance //
-	userBalance, err2 := t.checkBalance(stub, input.To, input.Token, true)
-	if err2 != nil {
-		return shim.Error(err2.Error())
-	}
-
-	// Transfer swapping amount to user //
-	userBalance.Amount += input.Amount
-	balances[input.To+" "+input.Token] = userBalance
-	transactions[input.Id] = input
-
-	// Update user balance //
-	err = t.updateBalance(stub, userBalance)
+	err = checkMaxSupply(token)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-
-	// Mint amount of tokens in the system and update state //
-	token.Supply += input.Amount
 	err = t.updateToken(stub, token)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	updateTokens := make(map[string]Token)
-	updateTokens[token.Symbol] = token
+	tokens := make(map[string]Token)
+	tokens[token.Symbol] = token
 
 	// Prepare output object with updates //
-	return generateOutput(balances, updateTokens, transactions)
-
+	return generateOutput(stub, EVENT_TOKEN_MINTED, balances, tokens, transactions)
 }
 
-// /* -------------------------------------------------------------------------------------------------
-// multiMint: This function is called to perform a minting of a particular token to a
-//            given list of addresses.
-// Token           string                     // Token to be minted
-// FromAddress     string                     // Address from with the minting is generated
-// Type            string                     // Type of transaction
-// TxnId           string                     // Id of the transactions
-// Date            string                     // Date of the transfer
-// TotalAmount     float64                    // Total Amount to mint
-// Transfers       map[string]float64         // List of transfer to do form minting
-// ------------------------------------------------------------------------------------------------- */
-
-// func (t *CoinBalanceSmartContract) multiMint(stub shim.ChaincodeStubInterface,
-// 	args []string) pb.Response {
-
-// 	// Retrieve information from the input //
-// 	if len(args) != 1 {
-// 		return shim.Error("ERROR: MINT FUNCTION SHOULD BE CALLED " +
-// 			"WITH 1 ARGUMENTS.")
-// 	}
-// 	input := MultiMinter{}
-// 	json.Unmarshal([]byte(args[0]), &input)
-
-// 	// Get state of the token from the Ledger //
-// 	token, err := t.getToken(stub, input.Token)
-// 	if err != nil {
-// 		return shim.Error(err.Error())
-// 	}
-
-// 	// Check if transfer is allowed //
-// 	err = t.checkTokenTransferConditions(stub, input.Token,
-// 		input.Date, input.TotalAmount)
-// 	if err != nil {
-// 		return shim.Error(err.Error())
-// 	}
-
-// 	transactions := make(map[string]Transfer)
-// 	balances := make(map[string]Balance)
-// 	transfer := {
-// 		Type: input.Type, From: input.AddressFrom, Date: input.Date
-// 	}
-
-// 	// Iterate throught all the transactions on the multitransfer call //
-// 	totalAmount := 0.
-// 	txnNum := 0
-// 	for addressTo, amount := range input.Transfers {
-// 		totalAmount += amount
-// 		txnId := input.TxnId + strconv.Itoa(txnNum)
-// 		// Check if 0 amount or equal address //
-// 		if input.FromAddress == addressTo || amount == 0 {
-// 			continue
-// 		}
-// 		// Check if receiver is already in transaction users list //
-// 		receiverBalance, inList = balances[addressTo+" "+input.Token]
-// 		if !inList {
-// 			receiverBalance, err = t.checkBalance(stub, addressTo, input.Token, true)
-// 			if err != nil {
-// 				return shim.Error(err.Error())
-// 			}
-// 		}
-// 		// Check that the sender holds the amount to send and transfer funds //
-// 		receiverBalance.Amount += amount
-// 		if err != nil {
-// 			return shim.Error(err.Error())
-// 		}
-// 		// Generate Transfer object //
-// 		transfer.To = addressTo
-// 		transfer.Amount = amount
-// 		transfer.Id = txnId
-
-// 		// Update balance of Receiver //
-// 		balances[addressTo+" "+input.Token] = receiverBalance
-// 		transactions[txnId] = transfer
-// 		++txnNum
-// 	}
-
-// 	if math.Abs(input.TotalAmount-totalAmount) < PRECISSION {
-// 		return shim.Error( "ERROR: TOTAL AMOUNT MINTED TO USERS SHOULD BE EQUAL " +
-// 			"TO THE TOTAL AMOUNT DESIRED TO MINT." )
-// 	}
-
-// 	// Update States of all the users that did some transaction //
-// 	for _, balance := range balances {
-// 		err = t.updateBalance(stub, balance)
-// 		if err != nil {
-// 			return shim.Error(err.Error())
-// 		}
-// 	}
-
-// 	// Mint amount of tokens in the system and update state //
-// 	token.Supply += totalAmount
-// 	err = t.updateToken(stub, token)
-// 	if err != nil {
-// 		return shim.Error(err.Error())
-// 	}
-// 	tokens := make( map[string]Token )
-// 	tokens[token.Symbol] = token
-
-// 	// Prepare output object with updates //
-// 	outputBytes, errOut := t.generateOutput(stub, balances, tokens, transactions)
-// 	if errOut != nil {
-// 		return shim.Error(errOut.Error())
-// 	}
-// 	return shim.Success(outputBytes)
-// }
-
 /* -------------------------------------------------------------------------------------------------
 burn: This function is called to perform a swapping back of user's token in Fabric version by the
           same amount on original token version. It burns the Fabric tokens of the user.
@@ -1010,9 +4140,9 @@ Type               string   // Type of mint
 Token              string   // Symbol of the token to swap
 From               string   // From minting (Ethereum, Pod..)
 To                 string   // Id of the receiver of the tokens
-Amount             float64  // Amount of tokens to mint
+Amount             string   // Amount of tokens to burn in base units
 TxnId              string   // ID of the transaction
-Date               float64  // Date timestamp
+Date               int64    // Client date in seconds, replaced by the transaction timestamp
 ------------------------------------------------------------------------------------------------- */
 
 func (t *CoinBalanceSmartContract) burn(stub shim.ChaincodeStubInterface,
@@ -1032,6 +4162,26 @@ func (t *CoinBalanceSmartContract) burn(stub shim.ChaincodeStubInterface,
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	err = input.Amount.Resolve(token.Decimals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkTokenStatus(token, TOKEN_ACTIVE, TOKEN_DELISTING)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Date operation with the transaction timestamp //
+	err = stampTransferDate(stub, &input)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Reject operations that were already processed //
+	err = checkTransactionNotProcessed(stub, input.Id)
+	if err != nil {
+		return errorResponse(err)
+	}
 
 	// Retrieve user balance //
 	userBalance, err2 := t.checkBalance(stub, input.From, input.Token, true)
@@ -1039,8 +4189,8 @@ func (t *CoinBalanceSmartContract) burn(stub shim.ChaincodeStubInterface,
 		return shim.Error(err2.Error())
 	}
 
-	// Burn amount from user //
-	userBalance.Amount, err = saveSubstraction(userBalance.Amount, input.Amount)
+	// Burn amount from the vested funds of the user //
+	userBalance, err = withdrawFromBalance(stub, userBalance, input.Amount, NewAmount(0))
 	if err != nil {
 		return shim.Error(err.Error())
 	}
@@ -1065,8 +4215,42 @@ func (t *CoinBalanceSmartContract) burn(stub shim.ChaincodeStubInterface,
 	updateTokens := make(map[string]Token)
 	updateTokens[token.Symbol] = token
 
+	// Register transaction as processed //
+	err = recordTransaction(stub, input)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Prepare output object with updates //
-	return generateOutput(balances, updateTokens, transactions)
+	return generateOutput(stub, EVENT_TOKEN_BURNED, balances, updateTokens, transactions)
+}
+
+/* -------------------------------------------------------------------------------------------------
+getTransaction: this function retrieves a processed transaction with its Fabric TxID and timestamp
+Id                    string    // Id of the transaction (args[0])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) getTransaction(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: GETTRANSACTION FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+
+	record := TransactionRecord{Transfer: Transfer{Id: args[0]}}
+	isLoaded, err := record.LoadState(stub)
+	if err != nil {
+		return shim.Error("ERROR: GETTING THE TRANSACTION " + args[0] + ". " +
+			err.Error())
+	}
+	if !isLoaded {
+		return shim.Error("ERROR: TRANSACTION " + args[0] + " IS NOT REGISTERED " +
+			"ON THE SYSTEM.")
+	}
+	recordBytes, _ := json.Marshal(record)
+	return shim.Success(recordBytes)
 }
 
 /* -------------------------------------------------------------------------------------------------
@@ -1077,6 +4261,10 @@ address               string    // address to get balances
 func (t *CoinBalanceSmartContract) getBalancesOfAddress(stub shim.ChaincodeStubInterface,
 	args []string) pb.Response {
 
+	if err := checkArgs(args, 1, "getBalancesOfAddress"); err != nil {
+		return shim.Error(err.Error())
+	}
+
 	balances, err := findAllBalacesOfAddress(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
@@ -1094,6 +4282,10 @@ address               string    // address to get balances
 func (t *CoinBalanceSmartContract) getBalancesOfTokenHolders(stub shim.ChaincodeStubInterface,
 	args []string) pb.Response {
 
+	if err := checkArgs(args, 1, "getBalancesOfTokenHolders"); err != nil {
+		return shim.Error(err.Error())
+	}
+
 	balances, err := findAllHoldersOfToken(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
@@ -1103,19 +4295,187 @@ func (t *CoinBalanceSmartContract) getBalancesOfTokenHolders(stub shim.Chaincode
 	return shim.Success(outputBytes)
 }
 
+/* -------------------------------------------------------------------------------------------------
+getTokenHoldersPage: this function retrieves a page of the holders of a token, as addresses or as
+                     balances. Holders can be sorted by Amount or Address.
+Token                 string    // Symbol of the token (args[0])
+PageSize              int32     // Number of records of the page (args[1])
+Bookmark              string    // Bookmark returned by the previous page
+SortBy                string    // Amount or Address
+SortOrder             string    // asc or desc
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) getTokenHoldersPage(stub shim.ChaincodeStubInterface,
+	args []string, onlyAddresses bool) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: TOKEN HOLDERS PAGE FUNCTIONS SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+	pageQuery := PageQuery{}
+	err := json.Unmarshal([]byte(args[1]), &pageQuery)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+
+	balances, page, err := findHoldersOfTokenPage(stub, args[0], pageQuery)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	page.Records = balances
+	if onlyAddresses {
+		holderList := []string{}
+		for _, balance := range balances {
+			holderList = append(holderList, balance.Address)
+		}
+		page.Records = holderList
+	}
+	pageBytes, _ := json.Marshal(page)
+	return shim.Success(pageBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+getTokensByTypePage: this function retrieves a page of the tokens of a type, as symbols or as
+                     tokens. Tokens can be sorted by Symbol or Name.
+TokenType             string    // Type of the tokens (args[0])
+PageSize              int32     // Number of records of the page (args[1])
+Bookmark              string    // Bookmark returned by the previous page
+SortBy                string    // Symbol or Name
+SortOrder             string    // asc or desc
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) getTokensByTypePage(stub shim.ChaincodeStubInterface,
+	args []string, onlySymbols bool) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 2 {
+		return shim.Error("ERROR: TOKEN TYPE PAGE FUNCTIONS SHOULD BE CALLED " +
+			"WITH TWO ARGUMENTS.")
+	}
+	pageQuery := PageQuery{}
+	err := json.Unmarshal([]byte(args[1]), &pageQuery)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+
+	tokens, page, err := findTokensByTypePage(stub, args[0], pageQuery)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	page.Records = tokens
+	if onlySymbols {
+		tokenList := []string{}
+		for _, token := range tokens {
+			tokenList = append(tokenList, token.Symbol)
+		}
+		page.Records = tokenList
+	}
+	pageBytes, _ := json.Marshal(page)
+	return shim.Success(pageBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+migrateDocTypes: this function rewrites the states stored before the docType field was introduced,
+                 by batches of MAX_PAGE_SIZE states. It should be called again with the returned
+                 bookmark until the bookmark is empty. Migrating balances also fills the holders
+                 and the token balances indexes.
+docType               string    // balance, token or financialScores (args[0])
+Bookmark              string    // Bookmark returned by the previous batch (optional args[1])
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) migrateDocTypes(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("ERROR: MIGRATEDOCTYPES FUNCTION SHOULD BE CALLED " +
+			"WITH ONE OR TWO ARGUMENTS.")
+	}
+	page := MigrationPage{DocType: args[0]}
+	if len(args) == 2 {
+		page.Bookmark = args[1]
+	}
+
+	// Rewrite states of the given document type //
+	var err error
+	switch page.DocType {
+	case DOC_TYPE_BALANCE:
+		it, errIt := stub.GetStateByPartialCompositeKey(IndexBalances, []string{})
+		if errIt != nil {
+			return shim.Error(errIt.Error())
+		}
+		page, err = migrateStates(it, page, func(key string, value []byte) error {
+			balance := Balance{}
+			if err := balance.FromLedgerValue(value); err != nil {
+				return err
+			}
+			return t.updateBalance(stub, balance)
+		})
+
+	case DOC_TYPE_TOKEN:
+		it, errIt := stub.GetStateByPartialCompositeKey(IndexToken, []string{})
+		if errIt != nil {
+			return shim.Error(errIt.Error())
+		}
+		page, err = migrateStates(it, page, func(key string, value []byte) error {
+			token := Token{}
+			if err := token.FromLedgerValue(value); err != nil {
+				return err
+			}
+			return token.SaveState(stub)
+		})
+
+	case DOC_TYPE_FINANCIAL_SCORES:
+		// Financial scores are stored under raw keys, read by key range //
+		it, errIt := stub.GetStateByRange(IndexFinancialScores,
+			IndexFinancialScores+string(utf8.MaxRune))
+		if errIt != nil {
+			return shim.Error(errIt.Error())
+		}
+		page, err = migrateStates(it, page, func(key string, value []byte) error {
+			scores := FinancialScores{}
+			if err := json.Unmarshal(value, &scores); err != nil {
+				return err
+			}
+			scores.DocType = DOC_TYPE_FINANCIAL_SCORES
+			scoresBytes, _ := json.Marshal(scores)
+			return stub.PutState(key, scoresBytes)
+		})
+
+	default:
+		return shim.Error("ERROR: UNKNOWN DOC TYPE " + page.DocType)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	pageBytes, _ := json.Marshal(page)
+	return shim.Success(pageBytes)
+}
+
 /* -------------------------------------------------------------------------------------------------
 updateTokenInfo: this function updates the information of a given Token already registered in the
-                 system (keeping the supply)/
+                 system (keeping the supply and the decimals). The maximum supply is given in base
+                 units and cannot be lower than the current supply (0 for no cap). The maximum
+                 supply is kept when the input has no MaxSupply.
 ------------------------------------------------------------------------------------------------- */
 
 func (t *CoinBalanceSmartContract) updateTokenInfo(stub shim.ChaincodeStubInterface,
 	args []string) pb.Response {
 
+	if err := checkArgs(args, 1, "updateTokenInfo"); err != nil {
+		return shim.Error(err.Error())
+	}
+
 	token := Token{}
 	err := json.Unmarshal([]byte(args[0]), &token)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	input := struct {
+		MaxSupply *Amount `json:"MaxSupply"`
+	}{}
+	json.Unmarshal([]byte(args[0]), &input)
 
 	// Get state of the token from the Ledger //
 	var tokenOld Token
@@ -1124,8 +4484,21 @@ func (t *CoinBalanceSmartContract) updateTokenInfo(stub shim.ChaincodeStubInterf
 		return shim.Error(err.Error())
 	}
 
-	// Keep Supply //
+	// Keep Supply, Decimals and Status, and the maximum supply when it is not given //
 	token.Supply = tokenOld.Supply
+	token.Decimals = tokenOld.Decimals
+	token.Status = tokenOld.Status
+	if input.MaxSupply == nil {
+		token.MaxSupply = tokenOld.MaxSupply
+	}
+	err = token.MaxSupply.Resolve(token.Decimals)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = checkMaxSupply(token)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	err = t.updateToken(stub, token)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -1133,7 +4506,7 @@ func (t *CoinBalanceSmartContract) updateTokenInfo(stub shim.ChaincodeStubInterf
 	updateTokens := make(map[string]Token)
 	updateTokens[token.Symbol] = token
 
-	return generateOutput(nil, updateTokens, nil)
+	return generateOutput(stub, EVENT_TOKEN_UPDATED, nil, updateTokens, nil)
 }
 
 /* -------------------------------------------------------------------------------------------------
@@ -0,0 +1,216 @@
+///////////////////////////////////////////////////////////////////
+// File containing the access control of the Coin Balance Smart
+// Contract. Every function is checked against an access rule stored
+// on the ledger, which is seeded at Init and managed by the admins.
+///////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+/* -------------------------------------------------------------------------------------------------
+ Default access rules seeded at Init. Functions without roles can be called by any identity of the
+ network, they are protected by the signatures of the addresses or are read only.
+------------------------------------------------------------------------------------------------- */
+
+var adminFunctions = []string{
+	"registerToken", "removeToken", "setTokenStatus", "redeemToken", "reuseTokenSymbol",
+	"multiMint", "burn", "setCreditPool", "createAirdrop", "reclaimAirdrop",
+	"auditToken", "revokeVesting", "updateConfig", "initialiseBalance",
+	"initialiseFinancialScores", "updateFinancialScores", "migrateDocTypes",
+	"updateTokenInfo", "setAccessRule", "removeAccessRule", "setFeeSchedule", "setMinterQuota",
+	"removeMinterQuota", "mintItem", "distributeDividend", "cancelDividend",
+}
+
+// Minters can only mint within their quota, callers without quota are checked against the //
+// rule of mintWithoutQuota                                                                  //
+var minterFunctions = []string{
+	"mint",
+}
+
+// Permissions checked by the functions themselves, which have a rule but no route //
+var internalFunctions = []string{
+	"mintWithoutQuota",
+}
+
+var guarantorFunctions = []string{
+	"grantCredit", "grantPoolCredit",
+}
+
+var publicFunctions = []string{
+	"getTokenInfoByType", "getTokenListByType", "getToken", "getArchivedTokens",
+	"registerAddress", "unregisterAddress", "confirmPrimaryAddress", "getWallet",
+	"checkAddressExist", "getWalletType", "balanceOf", "transfer", "multitransfer", "approve",
+	"increaseAllowance", "decreaseAllowance", "allowance", "transferFrom", "getCreditLine",
+	"getCreditPool", "getPoolCredits", "spendFunds", "claim", "getTokenAudits", "getAirdrop",
+	"getVestingSchedule", "getConfig", "getFinancialScores", "getBalancesOfAddress",
+	"getBalancesOfTokenHolders", "getNonce", "getHistory", "getTransaction",
+	"getTokenHolderList", "getTokenHolderListPage", "getBalancesOfTokenHoldersPage",
+	"getTokenListByTypePage", "getTokenInfoByTypePage", "getAccessRule", "getAccessRules",
+	"propose", "approveProposal", "executeProposal", "getProposal", "getGovernance", "getIdentity",
+	"getFeeSchedule", "getMinterQuota", "getMinterQuotas", "transferItem", "approveItem",
+	"setItemOperator", "ownerOf", "getItem", "getItemsOfOwner", "isItemOperator", "getDividend",
+	"approveAddress", "repayPoolCredit",
+}
+
+// Functions that can only be run through a governance proposal once the governance is set //
+var governedFunctions = []string{
+	"mint", "multiMint", "registerToken", "reuseTokenSymbol", "updateTokenInfo", "mintItem",
+}
+
+// Governed functions checking the governance themselves, as minters can mint within their quota //
+var selfGovernedFunctions = []string{"mint"}
+
+// Functions whose rule should always allow the admins, so that the table cannot lock them out //
+var aclFunctions = []string{"setAccessRule", "removeAccessRule"}
+
+// Functions rewriting the stored states, whose rule should only ever allow the admins //
+var adminOnlyFunctions = []string{"migrateDocTypes"}
+
+func defaultAccessRules() []AccessRule {
+	rules := []AccessRule{}
+	for _, function := range adminFunctions {
+		rules = append(rules, AccessRule{Function: function, Roles: []string{ADMIN_ROLE}})
+	}
+	for _, function := range internalFunctions {
+		rules = append(rules, AccessRule{Function: function, Roles: []string{ADMIN_ROLE}})
+	}
+	for _, function := range minterFunctions {
+		rules = append(rules, AccessRule{
+			Function: function, Roles: []string{ADMIN_ROLE, MINTER_ROLE}})
+	}
+	for _, function := range guarantorFunctions {
+		rules = append(rules, AccessRule{
+			Function: function, Roles: []string{ADMIN_ROLE, GUARANTOR_ROLE}})
+	}
+	for _, function := range publicFunctions {
+		rules = append(rules, AccessRule{Function: function})
+	}
+	return rules
+}
+
+/* -------------------------------------------------------------------------------------------------
+ seedAccessRules: this function stores the default rule of every function that has no rule yet, so
+                  the rules changed by the admins are kept on upgrades
+------------------------------------------------------------------------------------------------- */
+
+func seedAccessRules(stub shim.ChaincodeStubInterface) error {
+	for _, rule := range defaultAccessRules() {
+		stored := AccessRule{Function: rule.Function}
+		isLoaded, err := stored.LoadState(stub)
+		if err != nil {
+			return err
+		}
+		if isLoaded {
+			continue
+		}
+		if err = rule.SaveState(stub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+ checkAccess: this function checks the caller against the access rule of a function. The caller
+              should have one of the roles and belong to one of the MSPs of the rule, when they are
+              set, and satisfy every attribute predicate of the rule.
+------------------------------------------------------------------------------------------------- */
+
+func checkAccess(stub shim.ChaincodeStubInterface, function string) error {
+
+	rule := AccessRule{Function: function}
+	isLoaded, err := rule.LoadState(stub)
+	if err != nil {
+		return errors.New("ERROR: GETTING THE ACCESS RULE OF " + function + ". " + err.Error())
+	}
+	if !isLoaded {
+		return errors.New("PERMISSION DENIED TO CALL " + function +
+			". THE FUNCTION HAS NO ACCESS RULE.")
+	}
+
+	// Check roles and MSP of the caller //
+	if len(rule.Roles) > 0 {
+		if err = checkAnyPermission(stub, rule.Roles, function); err != nil {
+			return err
+		}
+	}
+	if len(rule.MSPs) > 0 {
+		mspId, err := cid.GetMSPID(stub)
+		if err != nil || !stringInSlice(mspId, rule.MSPs) {
+			return errors.New("PERMISSION DENIED TO CALL " + function)
+		}
+	}
+
+	// Check attribute predicates of the caller //
+	for name, value := range rule.Attributes {
+		attribute, found, err := cid.GetAttributeValue(stub, name)
+		if err != nil || !found || (value != ANY_ATTRIBUTE_VALUE && attribute != value) {
+			return errors.New("PERMISSION DENIED TO CALL " + function)
+		}
+	}
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+ getAccessRules: this function returns all the access rules stored on the ledger
+------------------------------------------------------------------------------------------------- */
+
+func getAccessRules(stub shim.ChaincodeStubInterface) ([]AccessRule, error) {
+	it, err := stub.GetStateByPartialCompositeKey(IndexAccessRules, []string{})
+	if err != nil {
+		return nil, errors.New("ERROR: unable to get an iterator over the access rules")
+	}
+	defer it.Close()
+	rules := []AccessRule{}
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return nil, errors.New(message)
+		}
+		var rule AccessRule
+		if err = json.Unmarshal(response.Value, &rule); err != nil {
+			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
+			return nil, errors.New(message)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+ checkNotGoverned: this function rejects the direct calls to the governed functions once the
+                   governance is set, as they should be run through a proposal
+------------------------------------------------------------------------------------------------- */
+
+func checkNotGoverned(stub shim.ChaincodeStubInterface, function string) error {
+	if !stringInSlice(function, governedFunctions) ||
+		stringInSlice(function, selfGovernedFunctions) {
+		return nil
+	}
+	return checkGovernanceNotSet(stub, function)
+}
+
+/* -------------------------------------------------------------------------------------------------
+ checkGovernanceNotSet: this function rejects a direct call to a function once the governance is set
+------------------------------------------------------------------------------------------------- */
+
+func checkGovernanceNotSet(stub shim.ChaincodeStubInterface, function string) error {
+	_, isSet, err := getGovernance(stub)
+	if err != nil {
+		return err
+	}
+	if isSet {
+		return errors.New("PERMISSION DENIED TO CALL " + function + ". IT SHOULD BE " +
+			"EXECUTED THROUGH A GOVERNANCE PROPOSAL.")
+	}
+	return nil
+}
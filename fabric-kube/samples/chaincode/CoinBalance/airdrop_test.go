@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Builds a Merkle tree with sorted pairs and returns its root and the proof of every leaf //
+func buildMerkleTree(leaves [][]byte) ([]byte, [][]string) {
+	proofs := make([][]string, len(leaves))
+	positions := make([]int, len(leaves))
+	for i := range positions {
+		positions[i] = i
+	}
+	level := leaves
+	for len(level) > 1 {
+		next := [][]byte{}
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			left, right := level[i], level[i+1]
+			if bytes.Compare(left, right) > 0 {
+				left, right = right, left
+			}
+			next = append(next, crypto.Keccak256(left, right))
+		}
+		for leaf, position := range positions {
+			sibling := position ^ 1
+			if sibling < len(level) {
+				proofs[leaf] = append(proofs[leaf], hexutil.Encode(level[sibling]))
+			}
+			positions[leaf] = position / 2
+		}
+		level = next
+	}
+	return level[0], proofs
+}
+
+func TestVerifyMerkleProof(t *testing.T) {
+	addresses := []string{"0xA", "0xB", "0xC", "0xD", "0xE"}
+	leaves := [][]byte{}
+	for i, address := range addresses {
+		leaves = append(leaves, airdropLeaf(uint64(i), address, NewAmount(int64(100*(i+1)))))
+	}
+	root, proofs := buildMerkleTree(leaves)
+	rootHex := hexutil.Encode(root)
+	otherRoot, _ := buildMerkleTree(leaves[:4])
+
+	tests := []struct {
+		name  string
+		root  string
+		leaf  []byte
+		proof []string
+		valid bool
+		err   bool
+	}{
+		{"first leaf", rootHex, leaves[0], proofs[0], true, false},
+		{"middle leaf", rootHex, leaves[2], proofs[2], true, false},
+		{"last leaf", rootHex, leaves[4], proofs[4], true, false},
+		{"wrong root", hexutil.Encode(otherRoot), leaves[0], proofs[0], false, false},
+		{"tampered amount", rootHex, airdropLeaf(0, "0xA", NewAmount(1000)), proofs[0],
+			false, false},
+		{"tampered index", rootHex, airdropLeaf(1, "0xA", NewAmount(100)), proofs[0],
+			false, false},
+		{"tampered address", rootHex, airdropLeaf(0, "0xB", NewAmount(100)), proofs[0],
+			false, false},
+		{"proof of another leaf", rootHex, leaves[0], proofs[1], false, false},
+		{"empty proof", rootHex, leaves[0], []string{}, false, false},
+		{"short node", rootHex, leaves[0], []string{"0x1234"}, false, true},
+		{"invalid node", rootHex, leaves[0], []string{"node"}, false, true},
+		{"invalid root", "root", leaves[0], proofs[0], false, true},
+	}
+	for _, test := range tests {
+		valid, err := verifyMerkleProof(test.root, test.leaf, test.proof)
+		if test.err != (err != nil) {
+			t.Errorf("%s: unexpected error result %v", test.name, err)
+		}
+		if test.valid != valid {
+			t.Errorf("%s: expected %v, got %v", test.name, test.valid, valid)
+		}
+	}
+}
+
+func claimArgs(t *testing.T, claim AirdropClaim) string {
+	claimBytes, err := json.Marshal(claim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(claimBytes)
+}
+
+func (l *testLedger) airdrop(airdropId string) Airdrop {
+	var airdrop Airdrop
+	l.must(l.run(0, func(stub shim.ChaincodeStubInterface) error {
+		var err error
+		airdrop, err = getAirdrop(stub, airdropId)
+		return err
+	}))
+	return airdrop
+}
+
+func TestClaimAndReclaimAirdrop(t *testing.T) {
+	l := newTestLedger(t)
+	l.registerToken("PRIVI", "CRYPTO", NewAmount(1000))
+	addresses := []string{"0xA", "0xB", "0xC"}
+	for _, address := range append(addresses, "0xF") {
+		l.registerWallet(address)
+	}
+	l.setBalance("0xF", "PRIVI", NewAmount(1000), NewAmount(0))
+	leaves := [][]byte{}
+	for i, address := range addresses {
+		leaves = append(leaves, airdropLeaf(uint64(i), address, NewAmount(int64(100*(i+1)))))
+	}
+	root, proofs := buildMerkleTree(leaves)
+
+	// The total of the airdrop is escrowed from the funder //
+	airdrop := Airdrop{
+		Id: "drop1", Token: "PRIVI", Root: hexutil.Encode(root), Funder: "0xF",
+		Total: NewAmount(600), Expiry: 1000}
+	airdropBytes, _ := json.Marshal(airdrop)
+	l.mustCall(100, l.contract.createAirdrop, string(airdropBytes))
+	if balance := l.balance("0xF", "PRIVI"); balance.Cmp(NewAmount(400)) != 0 {
+		t.Fatalf("expected the funder to hold 400, got %s", balance.String())
+	}
+
+	// A leaf is claimed once and only with its own proof //
+	claim := AirdropClaim{
+		AirdropId: "drop1", Index: 0, Address: "0xA", Amount: NewAmount(100), Proof: proofs[0]}
+	l.mustCall(200, l.contract.claim, claimArgs(t, claim))
+	if balance := l.balance("0xA", "PRIVI"); balance.Cmp(NewAmount(100)) != 0 {
+		t.Fatalf("expected the claimer to hold 100, got %s", balance.String())
+	}
+	if response := l.call(300, l.contract.claim, claimArgs(t, claim)); response.Status == shim.OK {
+		t.Fatal("a leaf should not be claimed twice")
+	}
+	claim = AirdropClaim{
+		AirdropId: "drop1", Index: 1, Address: "0xB", Amount: NewAmount(200), Proof: proofs[0]}
+	if response := l.call(300, l.contract.claim, claimArgs(t, claim)); response.Status == shim.OK {
+		t.Fatal("a claim with the proof of another leaf should be rejected")
+	}
+	if remaining := l.airdrop("drop1").Remaining; remaining.Cmp(NewAmount(500)) != 0 {
+		t.Fatalf("expected 500 left in the airdrop, got %s", remaining.String())
+	}
+
+	// The unclaimed funds are returned to the funder only after the expiry //
+	if response := l.call(500, l.contract.reclaimAirdrop, "drop1"); response.Status == shim.OK {
+		t.Fatal("the airdrop should not be reclaimed before its expiry")
+	}
+	claim.Proof = proofs[1]
+	if response := l.call(1000, l.contract.claim, claimArgs(t, claim)); response.Status == shim.OK {
+		t.Fatal("an expired airdrop should not be claimed")
+	}
+	l.mustCall(1000, l.contract.reclaimAirdrop, "drop1")
+	if balance := l.balance("0xF", "PRIVI"); balance.Cmp(NewAmount(900)) != 0 {
+		t.Fatalf("expected the funder to hold 900, got %s", balance.String())
+	}
+	if remaining := l.airdrop("drop1").Remaining; !remaining.IsZero() {
+		t.Fatalf("expected nothing left in the airdrop, got %s", remaining.String())
+	}
+	if response := l.call(1100, l.contract.reclaimAirdrop, "drop1"); response.Status == shim.OK {
+		t.Fatal("the airdrop should not be reclaimed twice")
+	}
+}
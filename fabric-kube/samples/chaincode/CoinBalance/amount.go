@@ -0,0 +1,213 @@
+///////////////////////////////////////////////////////////////////
+// File containing the fixed-point Amount used for balances, supplies
+// and transfers. Amounts are integer base units of a token and are
+// serialised as JSON strings to avoid any floating point drift.
+///////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// Definition of an exact token amount in base units //
+type Amount struct {
+	units  *big.Int
+	legacy string
+}
+
+/* -------------------------------------------------------------------------------------------------
+ Amount constructors
+------------------------------------------------------------------------------------------------- */
+
+func NewAmount(units int64) Amount {
+	return Amount{units: big.NewInt(units)}
+}
+
+func NewAmountFromBig(units *big.Int) Amount {
+	return Amount{units: new(big.Int).Set(units)}
+}
+
+// Parses an integer amount of base units (e.g. "150000000") //
+func ParseAmount(units string) (Amount, error) {
+	value, ok := new(big.Int).SetString(strings.TrimSpace(units), 10)
+	if !ok {
+		return Amount{}, errors.New("ERROR: INVALID AMOUNT " + units +
+			". AMOUNTS SHOULD BE INTEGER BASE UNITS.")
+	}
+	return Amount{units: value}, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+ Arithmetic. Amounts are immutable, every operation returns a new Amount.
+------------------------------------------------------------------------------------------------- */
+
+func (a Amount) Int() *big.Int {
+	if a.units == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(a.units)
+}
+
+func (a Amount) Add(b Amount) Amount {
+	return Amount{units: new(big.Int).Add(a.Int(), b.Int())}
+}
+
+func (a Amount) Sub(b Amount) Amount {
+	return Amount{units: new(big.Int).Sub(a.Int(), b.Int())}
+}
+
+func (a Amount) Cmp(b Amount) int {
+	return a.Int().Cmp(b.Int())
+}
+
+func (a Amount) Sign() int {
+	return a.Int().Sign()
+}
+
+func (a Amount) IsZero() bool {
+	return a.Sign() == 0
+}
+
+func (a Amount) String() string {
+	return a.Int().String()
+}
+
+// Multiplies the amount by a factor, rounding down to base units //
+func (a Amount) MulFloat(factor float64) Amount {
+	ratio := new(big.Rat)
+	if ratio.SetFloat64(factor) == nil {
+		return NewAmount(0)
+	}
+	value := new(big.Rat).SetInt(a.Int())
+	value.Mul(value, ratio)
+	return Amount{units: new(big.Int).Quo(value.Num(), value.Denom())}
+}
+
+// Multiplies the amount by the fraction numerator/denominator, rounding down to base units //
+func (a Amount) MulDiv(numerator int64, denominator int64) Amount {
+	if denominator == 0 {
+		return NewAmount(0)
+	}
+	value := new(big.Int).Mul(a.Int(), big.NewInt(numerator))
+	return Amount{units: value.Quo(value, big.NewInt(denominator))}
+}
+
+// Multiplies the amount by the ratio numerator/denominator of two amounts, rounding down //
+func (a Amount) MulRatio(numerator Amount, denominator Amount) Amount {
+	if denominator.IsZero() {
+		return NewAmount(0)
+	}
+	value := new(big.Int).Mul(a.Int(), numerator.Int())
+	return Amount{units: value.Quo(value, denominator.Int())}
+}
+
+// Returns the smallest of two amounts //
+func MinAmount(a Amount, b Amount) Amount {
+	if a.Cmp(b) <= 0 {
+		return a
+	}
+	return b
+}
+
+// Returns the amount zero-padded to a fixed width so that amounts sort as strings //
+func (a Amount) SortKey() string {
+	units := a.String()
+	if len(units) >= AMOUNT_KEY_DIGITS {
+		return units
+	}
+	return strings.Repeat("0", AMOUNT_KEY_DIGITS-len(units)) + units
+}
+
+/* -------------------------------------------------------------------------------------------------
+ Decimals helpers
+------------------------------------------------------------------------------------------------- */
+
+// Returns 10^decimals, the number of base units of one whole token //
+func unitsPerToken(decimals int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+}
+
+// Returns the amount of a number of whole tokens in base units //
+func WholeTokens(count int64, decimals int) Amount {
+	return NewAmountFromBig(unitsPerToken(decimals)).MulDiv(count, 1)
+}
+
+// Checks that the amount is a whole number of tokens //
+func (a Amount) IsWhole(decimals int) bool {
+	remainder := new(big.Int).Mod(a.Int(), unitsPerToken(decimals))
+	return remainder.Sign() == 0
+}
+
+// Rounds the amount down to a whole number of tokens //
+func (a Amount) WholeFloor(decimals int) Amount {
+	units := unitsPerToken(decimals)
+	value := new(big.Int).Quo(a.Int(), units)
+	return Amount{units: value.Mul(value, units)}
+}
+
+// Returns true if the amount was decoded from a JSON number and is not resolved yet //
+func (a Amount) IsLegacy() bool {
+	return a.legacy != ""
+}
+
+// Converts a decimal amount received as a JSON number (e.g. 12.5) into base units of a token
+// with the given decimals. Amounts already expressed in base units are left untouched. //
+func (a *Amount) Resolve(decimals int) error {
+	if a.legacy == "" {
+		return nil
+	}
+	value, ok := new(big.Rat).SetString(a.legacy)
+	if !ok {
+		return errors.New("ERROR: INVALID AMOUNT " + a.legacy)
+	}
+	value.Mul(value, new(big.Rat).SetInt(unitsPerToken(decimals)))
+	if !value.IsInt() {
+		return errors.New("ERROR: AMOUNT " + a.legacy + " HAS MORE DECIMALS THAN " +
+			"THE TOKEN SUPPORTS.")
+	}
+	a.units = new(big.Int).Set(value.Num())
+	a.legacy = ""
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+ JSON encoding. Amounts are written as strings of base units. Strings are read as base units and
+ numbers are kept as decimal token amounts until they are resolved with the token decimals.
+------------------------------------------------------------------------------------------------- */
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	if a.legacy != "" {
+		return []byte(a.legacy), nil
+	}
+	return json.Marshal(a.String())
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	raw := strings.TrimSpace(string(data))
+	if raw == "null" {
+		*a = Amount{}
+		return nil
+	}
+	if strings.HasPrefix(raw, `"`) {
+		var units string
+		if err := json.Unmarshal(data, &units); err != nil {
+			return err
+		}
+		amount, err := ParseAmount(units)
+		if err != nil {
+			return err
+		}
+		*a = amount
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return errors.New("ERROR: INVALID AMOUNT " + raw)
+	}
+	*a = Amount{legacy: number.String()}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func (obj *AccessRule) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(obj)
+}
+
+func (obj *AccessRule) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	attributes := []string{obj.Function}
+
+	return stub.CreateCompositeKey(IndexAccessRules, attributes)
+}
+
+func (obj *AccessRule) SaveState(stub shim.ChaincodeStubInterface) error {
+	compositeKey, err := obj.ToCompositeKey(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		return errors.New(message)
+	}
+	var ledgerValue []byte
+	ledgerValue, err = obj.ToLedgerValue()
+	if err != nil {
+		message := fmt.Sprintf("unable to compose a ledger value: %s", err.Error())
+		return errors.New(message)
+	}
+
+	return stub.PutState(compositeKey, ledgerValue)
+}
+
+// returns false if a AccessRule object wasn't found in the ledger; otherwise returns true
+func (obj *AccessRule) LoadState(stub shim.ChaincodeStubInterface) (bool, error) {
+	compositeKey, err := obj.ToCompositeKey(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		return false, errors.New(message)
+	}
+
+	var ledgerValue []byte
+	ledgerValue, err = stub.GetState(compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to read the ledger value: %s", err.Error())
+		return false, errors.New(message)
+	}
+
+	if ledgerValue == nil {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(ledgerValue, &obj)
+}
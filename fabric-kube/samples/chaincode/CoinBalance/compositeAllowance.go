@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func (obj *Allowance) ToLedgerValue() ([]byte, error) {
+	return json.Marshal(obj)
+}
+
+// parses a ledger value of an allowance
+func (obj *Allowance) FromLedgerValue(ledgerValue []byte) error {
+	return json.Unmarshal(ledgerValue, obj)
+}
+
+func (obj *Allowance) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	attributes := []string{obj.Owner, obj.Spender, obj.Token}
+
+	return stub.CreateCompositeKey(IndexAllowances, attributes)
+}
+
+func (obj *Allowance) SaveState(stub shim.ChaincodeStubInterface) error {
+	compositeKey, err := obj.ToCompositeKey(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		return errors.New(message)
+	}
+	var ledgerValue []byte
+	ledgerValue, err = obj.ToLedgerValue()
+	if err != nil {
+		message := fmt.Sprintf("unable to compose a ledger value: %s", err.Error())
+		return errors.New(message)
+	}
+
+	return stub.PutState(compositeKey, ledgerValue)
+}
+
+// returns false if a Allowance object wasn't found in the ledger; otherwise returns true
+func (obj *Allowance) LoadState(stub shim.ChaincodeStubInterface) (bool, error) {
+	compositeKey, err := obj.ToCompositeKey(stub)
+	if err != nil {
+		message := fmt.Sprintf("unable to create a composite key: %s", err.Error())
+		return false, errors.New(message)
+	}
+
+	var ledgerValue []byte
+	ledgerValue, err = stub.GetState(compositeKey)
+	if err != nil {
+		message := fmt.Sprintf("unable to read the ledger value: %s", err.Error())
+		return false, errors.New(message)
+	}
+
+	if ledgerValue == nil {
+		return false, nil
+	}
+
+	return true, obj.FromLedgerValue(ledgerValue)
+}
@@ -7,10 +7,24 @@ import (
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 )
 
+// stores the balance with its document type and sortable amount key, used by the holder queries
 func (bal *Balance) ToLedgerValue() ([]byte, error) {
+	bal.AmountKey = bal.Amount.SortKey()
+	bal.DocType = DOC_TYPE_BALANCE
 	return json.Marshal(bal)
 }
 
+// parses a ledger value, converting balances stored before base units with the default decimals
+func (bal *Balance) FromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, bal); err != nil {
+		return err
+	}
+	if err := bal.Amount.Resolve(DEFAULT_DECIMALS); err != nil {
+		return err
+	}
+	return bal.Credit.Resolve(DEFAULT_DECIMALS)
+}
+
 func (bal *Balance) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
 	attributes := []string{
 		bal.Address,
@@ -55,5 +69,5 @@ func (bal *Balance) LoadState(stub shim.ChaincodeStubInterface) (bool, error) {
 		return false, nil
 	}
 
-	return true, json.Unmarshal(ledgerValue, &bal)
+	return true, bal.FromLedgerValue(ledgerValue)
 }
@@ -9,9 +9,25 @@ import (
 )
 
 func (obj *Token) ToLedgerValue() ([]byte, error) {
+	obj.DocType = DOC_TYPE_TOKEN
 	return json.Marshal(obj)
 }
 
+// parses a ledger value, tokens stored before base units get the default decimals and tokens
+// stored before the lifecycle are active
+func (obj *Token) FromLedgerValue(ledgerValue []byte) error {
+	if err := json.Unmarshal(ledgerValue, obj); err != nil {
+		return err
+	}
+	if obj.Supply.IsLegacy() {
+		obj.Decimals = DEFAULT_DECIMALS
+	}
+	if obj.Status == "" {
+		obj.Status = TOKEN_ACTIVE
+	}
+	return obj.Supply.Resolve(obj.Decimals)
+}
+
 func (obj *Token) ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error) {
 	attributes := []string{obj.Symbol}
 
@@ -53,5 +69,5 @@ func (obj *Token) LoadState(stub shim.ChaincodeStubInterface) (bool, error) {
 		return false, nil
 	}
 
-	return true, json.Unmarshal(ledgerValue, &obj)
+	return true, obj.FromLedgerValue(ledgerValue)
 }
@@ -17,8 +17,77 @@ const IndexNFTPODList = "NFT_POD_LIST"
 
 const IndexFinancialScores = "SCORES"
 const IndexBalances = "BALANCES"
+const IndexTransactions = "TRANSACTIONS"
+const IndexNonces = "NONCES"
+const IndexAllowances = "ALLOWANCES"
+const IndexCreditLines = "CREDIT_LINES"
+const IndexVestingSchedules = "VESTING_SCHEDULES"
+const IndexConfig = "CONFIG"
+const IndexHolders = "HOLDERS"
+const IndexArchivedTokens = "ARCHIVED_TOKENS"
+const IndexCreditPools = "CREDIT_POOLS"
+const IndexPoolCredits = "POOL_CREDITS"
+const IndexPremiums = "PREMIUMS"
+const IndexAirdrops = "AIRDROPS"
+const IndexClaimBitmaps = "CLAIM_BITMAPS"
+const IndexAudits = "AUDITS"
+const IndexAccessRules = "ACCESS_RULES"
+const IndexGovernance = "GOVERNANCE"
+const IndexProposals = "PROPOSALS"
+const IndexFeeSchedules = "FEE_SCHEDULES"
+const IndexMinterQuotas = "MINTER_QUOTAS"
+const IndexItems = "ITEMS"
+const IndexItemOwners = "ITEM_OWNERS"
+const IndexItemOperators = "ITEM_OPERATORS"
+const IndexDividends = "DIVIDENDS"
+const IndexDividendPayouts = "DIVIDEND_PAYOUTS"
+const IndexTokenBalances = "TOKEN_BALANCES"
+const IndexTokenAirdrops = "TOKEN_AIRDROPS"
+const IndexTokenDividends = "TOKEN_DIVIDENDS"
+const IndexTokenStates = "TOKEN_STATES"
 
-const PRECISSION = 1e-8
+// Document types of the states queried with CouchDB selectors //
+const DOC_TYPE_BALANCE = "balance"
+const DOC_TYPE_TOKEN = "token"
+const DOC_TYPE_ARCHIVED_TOKEN = "archivedToken"
+const DOC_TYPE_FINANCIAL_SCORES = "financialScores"
+
+// Decimals of the tokens registered before amounts were stored as base units //
+const DEFAULT_DECIMALS = 8
+const MAX_DECIMALS = 18
+
+// Page sizes of the paginated queries //
+const DEFAULT_PAGE_SIZE = 50
+const MAX_PAGE_SIZE = 200
+
+// Basis points of a whole amount, used by the percentage of the fee schedules //
+const BASIS_POINTS = 10000
+
+// Status of a governance proposal and default seconds before a proposal expires //
+const PROPOSAL_PENDING = "PENDING"
+const PROPOSAL_EXECUTED = "EXECUTED"
+const DEFAULT_PROPOSAL_LIFETIME = 7 * 24 * 3600
+
+// Action of a proposal changing the approvers and threshold of the governance //
+const UPDATE_GOVERNANCE_ACTION = "updateGovernance"
+
+// Status of a dividend distribution //
+const DIVIDEND_OPEN = "OPEN"
+const DIVIDEND_COMPLETED = "COMPLETED"
+const DIVIDEND_CANCELLED = "CANCELLED"
+
+// Number of claims of an airdrop tracked by each bitmap stored on the ledger //
+const CLAIM_BITMAP_WORD_SIZE = 256
+
+// Sort orders of the paginated queries //
+const SORT_ASC = "asc"
+const SORT_DESC = "desc"
+
+// Digits of the zero-padded amounts stored to sort balances (enough for 256 bit amounts) //
+const AMOUNT_KEY_DIGITS = 78
+
+// Default maximum difference in seconds between a client date and the transaction timestamp //
+const DEFAULT_MAX_DATE_SKEW = 300
 
 /*--------------------------------------------------
  TOKEN TYPES
@@ -32,6 +101,21 @@ var TOKEN_TYPES = []string{
 	CRYPTO_TOKEN, SOCIAL_TOKEN,
 	FT_POD_TOKEN, NFT_POD_TOKEN}
 
+/*--------------------------------------------------
+ TOKEN STATUS
+--------------------------------------------------*/
+
+// Lifecycle of a token: ACTIVE <-> PAUSED -> DELISTING -> ARCHIVED //
+const TOKEN_ACTIVE = "ACTIVE"
+const TOKEN_PAUSED = "PAUSED"
+const TOKEN_DELISTING = "DELISTING"
+const TOKEN_ARCHIVED = "ARCHIVED"
+
+var TOKEN_STATUS_TRANSITIONS = map[string][]string{
+	TOKEN_ACTIVE:    {TOKEN_PAUSED, TOKEN_DELISTING},
+	TOKEN_PAUSED:    {TOKEN_ACTIVE, TOKEN_DELISTING},
+	TOKEN_DELISTING: {TOKEN_ACTIVE, TOKEN_ARCHIVED}}
+
 /*--------------------------------------------------
  SYSTEM ROLES
 --------------------------------------------------*/
@@ -42,6 +126,74 @@ const BUSINESS_ROLE = "BUSINESS"
 const GUARANTOR_ROLE = "GUARANTOR"
 const COURTMEMBER_ROLE = "COURT_MEMBER"
 const EXCHANGE_ROLE = "EXCHANGE"
+const MINTER_ROLE = "MINTER"
+
+// Value of an attribute predicate of an access rule satisfied by any value of the attribute //
+const ANY_ATTRIBUTE_VALUE = "*"
+
+/*--------------------------------------------------
+ SIGNATURES
+--------------------------------------------------*/
+
+// Type hash prefixed to the canonical encoding of a signed transfer //
+const TRANSFER_TYPE = "PRIVI_TRANSFER(Token,From,To,Amount,Id,Nonce)"
+const MULTITRANSFER_TYPE = "PRIVI_MULTITRANSFER(From,Nonce,Transfers)"
+const APPROVE_TYPE = "PRIVI_APPROVE(Token,From,To,Amount,Id,Nonce)"
+const INCREASE_ALLOWANCE_TYPE = "PRIVI_INCREASE_ALLOWANCE(Token,From,To,Amount,Id,Nonce)"
+const DECREASE_ALLOWANCE_TYPE = "PRIVI_DECREASE_ALLOWANCE(Token,From,To,Amount,Id,Nonce)"
+const TRANSFER_FROM_TYPE = "PRIVI_TRANSFER_FROM(Token,From,To,Amount,Id,Nonce,Spender)"
+const ATTACH_ADDRESS_TYPE = "PRIVI_ATTACH_ADDRESS(PublicId,Address,Nonce)"
+const DETACH_ADDRESS_TYPE = "PRIVI_DETACH_ADDRESS(PublicId,Address,Nonce)"
+const SET_PRIMARY_ADDRESS_TYPE = "PRIVI_SET_PRIMARY_ADDRESS(PublicId,Address,Nonce)"
+const APPROVE_ADDRESS_TYPE = "PRIVI_APPROVE_ADDRESS(PublicId,Address,Approved,Nonce)"
+const SPEND_FUNDS_TYPE = "PRIVI_SPEND_FUNDS(Token,From,To,Amount,Id,Nonce)"
+const REPAY_POOL_CREDIT_TYPE = "PRIVI_REPAY_POOL_CREDIT(Token,From,To,Amount,Id,Nonce)"
+const TRANSFER_ITEM_TYPE = "PRIVI_TRANSFER_ITEM(Token,ItemId,From,To,Approved,Signer,Id,Nonce)"
+const APPROVE_ITEM_TYPE = "PRIVI_APPROVE_ITEM(Token,ItemId,From,To,Approved,Signer,Id,Nonce)"
+const SET_ITEM_OPERATOR_TYPE = "PRIVI_SET_ITEM_OPERATOR(Token,ItemId,From,To,Approved,Signer,Id,Nonce)"
+
+/*--------------------------------------------------
+ EVENTS
+--------------------------------------------------*/
+
+// Version of the payload of the events, increased on breaking changes //
+const EVENT_VERSION = 1
+
+const EVENT_TOKEN_TRANSFERRED = "TokenTransferred"
+const EVENT_TOKEN_TRANSFERRED_BATCH = "TokenTransferredBatch"
+const EVENT_TOKEN_MINTED = "TokenMinted"
+const EVENT_TOKEN_BURNED = "TokenBurned"
+const EVENT_TOKEN_REGISTERED = "TokenRegistered"
+const EVENT_TOKEN_UPDATED = "TokenUpdated"
+const EVENT_TOKEN_REMOVED = "TokenRemoved"
+const EVENT_TOKEN_STATUS_CHANGED = "TokenStatusChanged"
+const EVENT_TOKEN_REDEEMED = "TokenRedeemed"
+const EVENT_ALLOWANCE_CHANGED = "AllowanceChanged"
+const EVENT_CREDIT_LINE_GRANTED = "CreditLineGranted"
+const EVENT_CREDIT_POOL_UPDATED = "CreditPoolUpdated"
+const EVENT_FUNDS_SPENT = "FundsSpent"
+const EVENT_POOL_CREDIT_REPAID = "PoolCreditRepaid"
+const EVENT_AIRDROP_CREATED = "AirdropCreated"
+const EVENT_AIRDROP_CLAIMED = "AirdropClaimed"
+const EVENT_AIRDROP_RECLAIMED = "AirdropReclaimed"
+const EVENT_TOKEN_AUDITED = "TokenAudited"
+const EVENT_PROPOSAL_UPDATED = "ProposalUpdated"
+const EVENT_MINTER_QUOTA_UPDATED = "MinterQuotaUpdated"
+const EVENT_ITEM_MINTED = "ItemMinted"
+const EVENT_ITEM_TRANSFERRED = "ItemTransferred"
+const EVENT_ITEM_APPROVED = "ItemApproved"
+const EVENT_ITEM_OPERATOR_UPDATED = "ItemOperatorUpdated"
+const EVENT_DIVIDEND_DISTRIBUTED = "DividendDistributed"
+const EVENT_DIVIDEND_CANCELLED = "DividendCancelled"
+
+/*--------------------------------------------------
+ ERROR CODES
+--------------------------------------------------*/
+
+const DUPLICATE_TRANSACTION_CODE = 409
+
+// Separator of the Ids of the legs derived from a transaction, client Ids cannot contain it //
+const TRANSACTION_LEG_SEPARATOR = "_"
 
 /*--------------------------------------------------
  SMART CONTRACT INVOKATIONS
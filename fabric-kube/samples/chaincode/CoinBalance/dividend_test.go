@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func dividendArgs(t *testing.T, dividend Dividend, pageSize int32) []string {
+	dividendBytes, err := json.Marshal(dividend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageBytes, _ := json.Marshal(PageQuery{PageSize: pageSize})
+	return []string{string(dividendBytes), string(pageBytes)}
+}
+
+// Pod token with three holders and a credit line, so its balances exceed its supply //
+func newDividendLedger(t *testing.T) *testLedger {
+	l := newTestLedger(t)
+	l.registerToken("POD", FT_POD_TOKEN, NewAmount(550))
+	l.registerToken("PRIVI", "CRYPTO", NewAmount(1000))
+	l.registerWallet("0xS")
+	l.setBalance("0xS", "PRIVI", NewAmount(1000), NewAmount(0))
+	l.setBalance("0xA", "POD", NewAmount(300), NewAmount(0))
+	l.setBalance("0xB", "POD", NewAmount(200), NewAmount(0))
+	l.setBalance("0xC", "POD", NewAmount(100), NewAmount(0))
+	l.setBalance("0xD", "POD", NewAmount(0), NewAmount(50))
+	return l
+}
+
+func TestDistributeDividendInBatches(t *testing.T) {
+	l := newDividendLedger(t)
+	input := Dividend{
+		Id: "div1", PodToken: "POD", PayoutToken: "PRIVI", Source: "0xS",
+		TotalAmount: NewAmount(601)}
+	args := dividendArgs(t, input, 2)
+
+	// Two batches count the holders and two batches pay them //
+	statuses := []string{}
+	for i := 0; i < 4; i++ {
+		response := l.mustCall(100, l.contract.distributeDividend, args...)
+		output := Output{}
+		json.Unmarshal(response.Payload, &output)
+		dividend := output.UpdateDividends["div1"]
+		statuses = append(statuses, dividend.Status)
+		if i == 0 && l.token("POD").Status != TOKEN_PAUSED {
+			t.Fatal("the pod token should be paused while the dividend is open")
+		}
+		if i == 1 && (!dividend.Counted || dividend.PodSupply.Cmp(NewAmount(600)) != 0) {
+			t.Fatalf("the holder balances should be counted, got %s",
+				dividend.PodSupply.String())
+		}
+	}
+	expected := []string{DIVIDEND_OPEN, DIVIDEND_OPEN, DIVIDEND_OPEN, DIVIDEND_COMPLETED}
+	for i := range expected {
+		if statuses[i] != expected[i] {
+			t.Fatalf("batch %d: expected %s, got %s", i, expected[i], statuses[i])
+		}
+	}
+
+	// Shares of the summed balances, the rounding remainder goes back to the source //
+	payouts := map[string]int64{"0xA": 300, "0xB": 200, "0xC": 100, "0xD": 0, "0xS": 400}
+	for address, amount := range payouts {
+		if l.balance(address, "PRIVI").Cmp(NewAmount(amount)) != 0 {
+			t.Errorf("%s: expected %d, got %s", address, amount,
+				l.balance(address, "PRIVI").String())
+		}
+	}
+	if l.token("POD").Status != TOKEN_ACTIVE {
+		t.Error("the pod token should be resumed when the dividend completes")
+	}
+	if response := l.call(100, l.contract.distributeDividend, args...); response.Status == shim.OK {
+		t.Error("a completed dividend should not be distributed again")
+	}
+}
+
+func TestCancelDividend(t *testing.T) {
+	l := newDividendLedger(t)
+	input := Dividend{
+		Id: "div1", PodToken: "POD", PayoutToken: "PRIVI", Source: "0xS",
+		TotalAmount: NewAmount(600)}
+	args := dividendArgs(t, input, 2)
+
+	// Count the holders and pay the first batch before cancelling //
+	for i := 0; i < 3; i++ {
+		l.mustCall(100, l.contract.distributeDividend, args...)
+	}
+	l.mustCall(100, l.contract.cancelDividend, "div1")
+
+	if l.balance("0xA", "PRIVI").Cmp(NewAmount(300)) != 0 ||
+		l.balance("0xC", "PRIVI").Sign() != 0 {
+		t.Error("only the holders already paid should keep their payouts")
+	}
+	if l.balance("0xS", "PRIVI").Cmp(NewAmount(500)) != 0 {
+		t.Errorf("the escrow left should be refunded, got %s",
+			l.balance("0xS", "PRIVI").String())
+	}
+	if l.token("POD").Status != TOKEN_ACTIVE {
+		t.Error("the pod token should be resumed when the dividend is cancelled")
+	}
+	if response := l.call(100, l.contract.distributeDividend, args...); response.Status == shim.OK {
+		t.Error("a cancelled dividend should not be distributed again")
+	}
+	if response := l.call(100, l.contract.cancelDividend, "div1"); response.Status == shim.OK {
+		t.Error("a cancelled dividend should not be cancelled again")
+	}
+}
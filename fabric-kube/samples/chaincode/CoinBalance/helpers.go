@@ -8,13 +8,18 @@ package main
 
 import (
 	//"encoding/binary"
+	"bytes"
+	"crypto/ecdsa"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
+	"math/big"
+	"strings"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
@@ -36,46 +41,248 @@ func checkPermissions(stub shim.ChaincodeStubInterface, userRole string,
 }
 
 /* -------------------------------------------------------------------------------------------------
- validateSignature: this function validates when a user signs it.
+ checkAnyPermission: check if user has one of the roles allowed to call a given function
 ------------------------------------------------------------------------------------------------- */
 
-func validateSignature(publicKey string, hash string, signature string) error {
+func checkAnyPermission(stub shim.ChaincodeStubInterface, userRoles []string,
+	functionName string) error {
 
-	publicKeyBytes, err := hexutil.Decode(publicKey)
-	if err != nil {
-		return errors.New("ERROR: ERROR DECODING PUBLIC KEY " + publicKey)
+	for _, userRole := range userRoles {
+		if err := checkPermissions(stub, userRole, functionName); err == nil {
+			return nil
+		}
 	}
-	var hashBytes []byte
-	hashBytes, err = hexutil.Decode(hash)
+	return errors.New("PERMISSION DENIED TO CALL " + functionName)
+
+}
+
+/* -------------------------------------------------------------------------------------------------
+ transferDigest: this function computes the Keccak hash of the canonical encoding of a transfer.
+                 Every string field is hashed on its own and numbers are encoded as 32 bytes, so the
+                 encoding is unambiguous and can be reproduced with solidityKeccak256 on the client.
+------------------------------------------------------------------------------------------------- */
+
+func transferDigest(transfer Transfer) []byte {
+	return typedTransferDigest(TRANSFER_TYPE, transfer)
+}
+
+/* -------------------------------------------------------------------------------------------------
+ typedTransferDigest: this function computes the digest of a transfer for a given operation type, so
+                      a signature for one operation cannot be replayed as another one.
+------------------------------------------------------------------------------------------------- */
+
+func typedTransferDigest(operationType string, transfer Transfer) []byte {
+	nonce := new(big.Int).SetUint64(transfer.Nonce)
+	return crypto.Keccak256(
+		crypto.Keccak256([]byte(operationType)),
+		crypto.Keccak256([]byte(transfer.Token)),
+		crypto.Keccak256([]byte(transfer.From)),
+		crypto.Keccak256([]byte(transfer.To)),
+		common.LeftPadBytes(transfer.Amount.Int().Bytes(), 32),
+		crypto.Keccak256([]byte(transfer.Id)),
+		common.LeftPadBytes(nonce.Bytes(), 32))
+}
+
+/* -------------------------------------------------------------------------------------------------
+ transferFromDigest: this function computes the digest signed by the spender of an allowance
+------------------------------------------------------------------------------------------------- */
+
+func transferFromDigest(transfer Transfer) []byte {
+	return crypto.Keccak256(
+		typedTransferDigest(TRANSFER_FROM_TYPE, transfer),
+		crypto.Keccak256([]byte(transfer.Spender)))
+}
+
+/* -------------------------------------------------------------------------------------------------
+ signedMessageHash: this function computes the hash signed by Ethereum wallets (personal_sign)
+------------------------------------------------------------------------------------------------- */
+
+func signedMessageHash(digest []byte) []byte {
+	message := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(digest), digest)
+	return crypto.Keccak256([]byte(message))
+}
+
+/* -------------------------------------------------------------------------------------------------
+ signerMatches: this function checks if a public key corresponds to an address, which can be given
+                as an Ethereum address or as a compressed or uncompressed public key.
+------------------------------------------------------------------------------------------------- */
+
+func signerMatches(publicKey *ecdsa.PublicKey, address string) bool {
+	addressBytes, err := hexutil.Decode(address)
 	if err != nil {
-		return errors.New("ERROR: ERROR DECODING HASH")
+		return false
 	}
-	var signatureBytes []byte
-	signatureBytes, err = hexutil.Decode(signature)
+	switch len(addressBytes) {
+	case common.AddressLength:
+		return bytes.Equal(crypto.PubkeyToAddress(*publicKey).Bytes(), addressBytes)
+	case 33:
+		return bytes.Equal(crypto.CompressPubkey(publicKey), addressBytes)
+	case 65:
+		return bytes.Equal(crypto.FromECDSAPub(publicKey), addressBytes)
+	}
+	return false
+}
+
+/* -------------------------------------------------------------------------------------------------
+ validateSignature: this function recovers the signer of a digest and checks that it is the owner
+                    of the given address.
+------------------------------------------------------------------------------------------------- */
+
+func validateSignature(address string, digest []byte, signature string) error {
+
+	signatureBytes, err := hexutil.Decode(signature)
 	if err != nil {
 		return errors.New("ERROR: ERROR DECODING SIGNATURE")
 	}
+	if len(signatureBytes) != crypto.SignatureLength {
+		return fmt.Errorf("ERROR: THE SIGNATURE SHOULD HAVE %d BYTES",
+			crypto.SignatureLength)
+	}
+
+	// Normalise recovery id and reject malleable signatures //
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig, signatureBytes)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:64])
+	if !crypto.ValidateSignatureValues(sig[crypto.RecoveryIDOffset], r, s, true) {
+		return errors.New("ERROR: THE SIGNATURE VALUES ARE NOT VALID")
+	}
 
-	isVerified := crypto.VerifySignature(publicKeyBytes, hashBytes, signatureBytes[:len(signatureBytes)-1])
-	if !isVerified {
+	// Recover signer and compare with the address //
+	publicKey, err := crypto.SigToPub(signedMessageHash(digest), sig)
+	if err != nil {
+		return errors.New("ERROR: UNABLE TO RECOVER THE SIGNER. " + err.Error())
+	}
+	if !signerMatches(publicKey, address) {
 		return errors.New("ERROR: THE SIGNATURE IS NOT VALID. NO PERMISSIONS FOR ADDRESS " +
-			publicKey)
+			address)
 	}
 	return nil
 }
 
 /* -------------------------------------------------------------------------------------------------
-checkTokenListed:  this function checks if a token is listed.
+ multitransferDigest: this function computes the digest signed by a sender of a multitransfer. It
+                      covers the envelope nonce and the digests of the sender transfers in order.
+------------------------------------------------------------------------------------------------- */
+
+func multitransferDigest(sender string, nonce uint64, transfers []Transfer) []byte {
+	data := [][]byte{
+		crypto.Keccak256([]byte(MULTITRANSFER_TYPE)),
+		crypto.Keccak256([]byte(sender)),
+		common.LeftPadBytes(new(big.Int).SetUint64(nonce).Bytes(), 32)}
+	for _, transfer := range transfers {
+		data = append(data, transferDigest(transfer))
+	}
+	return crypto.Keccak256(data...)
+}
+
+/* -------------------------------------------------------------------------------------------------
+ checkMultitransferSignatures: this function validates the signed envelope of every sender of a
+                               multitransfer and consumes its nonce. Senders without envelope are
+                               only accepted when the caller is a settlement operator. It returns
+                               the senders that signed an envelope.
+------------------------------------------------------------------------------------------------- */
+
+func checkMultitransferSignatures(stub shim.ChaincodeStubInterface,
+	senderTransfers map[string][]Transfer, envelopes []SignedEnvelope) (map[string]bool, error) {
+
+	signed := make(map[string]bool)
+	for _, envelope := range envelopes {
+		transfers, inBatch := senderTransfers[envelope.From]
+		if !inBatch {
+			return nil, errors.New("ERROR: THE ENVELOPE OF " + envelope.From +
+				" DOES NOT MATCH ANY SENDER OF THE MULTITRANSFER.")
+		}
+		if signed[envelope.From] {
+			return nil, errors.New("ERROR: DUPLICATED ENVELOPE FOR " + envelope.From)
+		}
+		digest := multitransferDigest(envelope.From, envelope.Nonce, transfers)
+		err := validateSignature(envelope.From, digest, envelope.Signature)
+		if err != nil {
+			return nil, err
+		}
+		err = useNonce(stub, envelope.From, envelope.Nonce)
+		if err != nil {
+			return nil, err
+		}
+		signed[envelope.From] = true
+	}
+
+	// Check senders without envelope //
+	if len(signed) == len(senderTransfers) {
+		return signed, nil
+	}
+	err := checkAnyPermission(stub, []string{ADMIN_ROLE, EXCHANGE_ROLE},
+		"multitransfer")
+	if err != nil {
+		return nil, errors.New("ERROR: ALL THE SENDERS OF A MULTITRANSFER SHOULD SIGN " +
+			"AN ENVELOPE. " + err.Error())
+	}
+	return signed, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+ getNonce: this function returns the next nonce expected in a transfer signed by an address
+------------------------------------------------------------------------------------------------- */
+
+func getNonce(stub shim.ChaincodeStubInterface, address string) (AddressNonce, error) {
+
+	nonce := AddressNonce{Address: address}
+	_, err := nonce.LoadState(stub)
+	if err != nil {
+		return nonce, errors.New("ERROR: GETTING THE NONCE OF ADDRESS " + address +
+			". " + err.Error())
+	}
+	return nonce, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+ useNonce: this function checks the nonce of a signed transfer and increments the stored one
+------------------------------------------------------------------------------------------------- */
+
+func useNonce(stub shim.ChaincodeStubInterface, address string, nonce uint64) error {
+
+	stored, err := getNonce(stub, address)
+	if err != nil {
+		return err
+	}
+	if stored.Nonce != nonce {
+		return fmt.Errorf("ERROR: INVALID NONCE FOR ADDRESS %s. EXPECTED %d, GOT %d.",
+			address, stored.Nonce, nonce)
+	}
+	stored.Nonce++
+	return stored.SaveState(stub)
+}
+
+/* -------------------------------------------------------------------------------------------------
+checkTokenListed:  this function checks if a token is listed, that is registered and not archived.
 ------------------------------------------------------------------------------------------------- */
 
 func (t *CoinBalanceSmartContract) checkTokenListed(stub shim.ChaincodeStubInterface,
 	tokenSymbol string) error {
 
 	// Check if token is listed on blockchain //
-	tokenBytes, err := stub.GetState(IndexToken + tokenSymbol)
-	if err != nil || tokenBytes == nil {
-		return errors.New("ERROR: TOKEN " + tokenSymbol + " IS NOT REGISTERED " +
-			"ON THE SYSTEM. ")
+	token, err := t.getToken(stub, tokenSymbol)
+	if err != nil {
+		return err
+	}
+	if token.Status == TOKEN_ARCHIVED {
+		return errors.New("ERROR: TOKEN " + tokenSymbol + " IS ARCHIVED. ")
+	}
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+checkTokenStatus:  this function checks that the status of a token allows an operation.
+------------------------------------------------------------------------------------------------- */
+
+func checkTokenStatus(token Token, allowedStatus ...string) error {
+	if !stringInSlice(token.Status, allowedStatus) {
+		return errors.New("ERROR: THE OPERATION IS NOT ALLOWED WHILE THE TOKEN " +
+			token.Symbol + " IS " + token.Status + ".")
 	}
 	return nil
 }
@@ -125,6 +332,62 @@ func checkTokenRegistered(stub shim.ChaincodeStubInterface,
 	return true, nil
 }
 
+/* -------------------------------------------------------------------------------------------------
+archiveTokenSymbol:  this function frees the symbol of an archived token to register it again. It
+                     needs the override of an admin and keeps the archived token for audit.
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) archiveTokenSymbol(stub shim.ChaincodeStubInterface,
+	tokenSymbol string, reuseSymbol bool) error {
+
+	token, err := t.getToken(stub, tokenSymbol)
+	if err != nil {
+		return err
+	}
+	if token.Status != TOKEN_ARCHIVED || !reuseSymbol {
+		return errors.New("ERROR: TOKEN " + tokenSymbol + " ALREADY REGISTERED " +
+			"ON THE SYSTEM. ONLY SYMBOLS OF ARCHIVED TOKENS CAN BE REUSED WITH " +
+			"reuseTokenSymbol.")
+	}
+
+	// Keep archived token under the TxID freeing its symbol //
+	archiveKey, err := stub.CreateCompositeKey(IndexArchivedTokens,
+		[]string{tokenSymbol, stub.GetTxID()})
+	if err != nil {
+		return errors.New("ERROR: CREATING THE ARCHIVE KEY. " + err.Error())
+	}
+	token.DocType = DOC_TYPE_ARCHIVED_TOKEN
+	tokenBytes, _ := json.Marshal(token)
+	return stub.PutState(archiveKey, tokenBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+getArchivedTokens:  this function returns the previous archived tokens registered with a symbol
+------------------------------------------------------------------------------------------------- */
+
+func getArchivedTokens(stub shim.ChaincodeStubInterface, tokenSymbol string) ([]Token, error) {
+	it, err := stub.GetStateByPartialCompositeKey(IndexArchivedTokens, []string{tokenSymbol})
+	if err != nil {
+		return nil, errors.New("ERROR: unable to get an iterator over the archived tokens")
+	}
+	defer it.Close()
+	tokens := []Token{}
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return nil, errors.New(message)
+		}
+		var token Token
+		if err = token.FromLedgerValue(response.Value); err != nil {
+			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
+			return nil, errors.New(message)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
 /* -------------------------------------------------------------------------------------------------
 updateToken:  this function updates/register a token on blockchain
 ------------------------------------------------------------------------------------------------- */
@@ -145,7 +408,8 @@ getTokenInfoByType: returns the list of tokens with its system info of a given t
 
 func (t *CoinBalanceSmartContract) getTokenInfoByType(stub shim.ChaincodeStubInterface,
 	tokenType string) ([]Token, error) {
-	queryString := fmt.Sprintf(`{"selector":{"TokenType":"%s"}}`, tokenType)
+	queryString := fmt.Sprintf(`{"selector":{"docType":"%s","TokenType":"%s"}}`,
+		DOC_TYPE_TOKEN, tokenType)
 	it, err := stub.GetQueryResult(queryString)
 	if err != nil {
 		return nil, errors.New("ERROR: unable to get an iterator over the balances")
@@ -159,7 +423,7 @@ func (t *CoinBalanceSmartContract) getTokenInfoByType(stub shim.ChaincodeStubInt
 			return nil, errors.New(message)
 		}
 		var token Token
-		if err = json.Unmarshal(response.Value, &token); err != nil {
+		if err = token.FromLedgerValue(response.Value); err != nil {
 			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
 			return nil, errors.New(message)
 		}
@@ -174,7 +438,8 @@ getTokenListByType: returns the list of tokens with its system info of a given t
 
 func (t *CoinBalanceSmartContract) getTokenListByType(stub shim.ChaincodeStubInterface,
 	tokenType string) ([]string, error) {
-	queryString := fmt.Sprintf(`{"selector":{"TokenType":"%s"}}`, tokenType)
+	queryString := fmt.Sprintf(`{"selector":{"docType":"%s","TokenType":"%s"}}`,
+		DOC_TYPE_TOKEN, tokenType)
 	it, err := stub.GetQueryResult(queryString)
 	if err != nil {
 		return nil, errors.New("ERROR: unable to get an iterator over the balances")
@@ -188,7 +453,7 @@ func (t *CoinBalanceSmartContract) getTokenListByType(stub shim.ChaincodeStubInt
 			return nil, errors.New(message)
 		}
 		var token Token
-		if err = json.Unmarshal(response.Value, &token); err != nil {
+		if err = token.FromLedgerValue(response.Value); err != nil {
 			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
 			return nil, errors.New(message)
 		}
@@ -227,7 +492,7 @@ func (t *CoinBalanceSmartContract) checkBalance(stub shim.ChaincodeStubInterface
 	if !isLoaded {
 		balance = Balance{
 			Address: user, Token: token,
-			Amount: 0., Credit: 0.}
+			Amount: NewAmount(0), Credit: NewAmount(0)}
 	}
 
 	return balance, nil
@@ -242,6 +507,24 @@ func (t *CoinBalanceSmartContract) updateBalance(stub shim.ChaincodeStubInterfac
 	if err := balance.SaveState(stub); err != nil {
 		return err
 	}
+	if err := updateHolderIndex(stub, balance); err != nil {
+		return err
+	}
+	isOpen := !balance.Amount.IsZero() || !balance.Credit.IsZero()
+	return updateTokenIndex(stub, IndexTokenBalances, balance.Token, balance.Address, isOpen)
+}
+
+/* -------------------------------------------------------------------------------------------------
+updateBalances: this function updates all the balances modified in a call.
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) updateBalances(stub shim.ChaincodeStubInterface,
+	balances map[string]Balance) error {
+	for _, balance := range balances {
+		if err := t.updateBalance(stub, balance); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -270,162 +553,2269 @@ checkAddressExist: this function checks taht an user is registered
 func (t *CoinBalanceSmartContract) checkAddressExist(stub shim.ChaincodeStubInterface,
 	wallet string) bool {
 
-	result, err := stub.GetState(IndexWallets + wallet)
-	if err != nil || result == nil {
+	_, isLoaded, err := getWallet(stub, wallet)
+	if err != nil {
 		return false
 	}
-	return true
+	return isLoaded
 }
 
 /* -------------------------------------------------------------------------------------------------
-generateOutput: this function generates the output.
+getWallet: this function returns a registered wallet address. Addresses registered before actors
+           could hold several addresses are returned without owner.
 ------------------------------------------------------------------------------------------------- */
 
-func generateOutput(balances map[string]Balance, tokens map[string]Token,
-	transactions map[string]Transfer) pb.Response {
+func getWallet(stub shim.ChaincodeStubInterface, address string) (Wallet, bool, error) {
 
-	output := Output{UpdateBalances: balances,
-		UpdateTokens: tokens,
-		Transactions: transactions}
-	outputBytes, err := json.Marshal(output)
+	wallet := Wallet{Address: address}
+	isLoaded, err := wallet.LoadState(stub)
+	if err != nil || isLoaded {
+		return wallet, isLoaded, err
+	}
+
+	// Check raw key of the addresses registered without owner //
+	result, err := stub.GetState(IndexWallets + address)
 	if err != nil {
-		return shim.Error(err.Error())
+		return wallet, false, err
 	}
-	return shim.Success(outputBytes)
+	return wallet, result != nil, nil
 }
 
 /* -------------------------------------------------------------------------------------------------
-transferHelper: this function computes a transfer given balances and returns updated balances
+parseWalletOperation: this function reads the signed wallet operation of the input
 ------------------------------------------------------------------------------------------------- */
 
-func (t *CoinBalanceSmartContract) transferHelper(stub shim.ChaincodeStubInterface,
-	senderBalance float64, receiverBalance float64, amount float64) (float64, float64, error) {
+func parseWalletOperation(args []string) (WalletOperation, error) {
 
-	err := errors.New("")
-	// Substract fund from sender
-	senderBalance, err = saveSubstraction(senderBalance, amount)
+	operation := WalletOperation{}
+	if len(args) != 1 {
+		return operation, errors.New("ERROR: WALLET FUNCTIONS SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	err := json.Unmarshal([]byte(args[0]), &operation)
 	if err != nil {
-		return senderBalance, receiverBalance, err
+		return operation, errors.New("ERROR: GETTING INPUT INFORMATION. " + err.Error())
 	}
+	return operation, nil
+}
 
-	// Add funds to receiver
-	receiverBalance, err = saveAddition(receiverBalance, amount)
+/* -------------------------------------------------------------------------------------------------
+getOwnedWallet: this function returns the wallet of an operation if it is attached to its actor
+------------------------------------------------------------------------------------------------- */
+
+func getOwnedWallet(stub shim.ChaincodeStubInterface, operation WalletOperation) (Wallet, error) {
+
+	wallet, isLoaded, err := getWallet(stub, operation.Address)
 	if err != nil {
-		return senderBalance, receiverBalance, err
+		return wallet, err
+	}
+	if !isLoaded || wallet.PublicId != operation.PublicId {
+		return wallet, errors.New("ERROR: THE ADDRESS " + operation.Address +
+			" IS NOT ATTACHED TO " + operation.PublicId)
 	}
+	return wallet, nil
+}
 
-	return senderBalance, receiverBalance, nil
+/* -------------------------------------------------------------------------------------------------
+ walletOperationDigest: this function computes the digest of an operation on a wallet address
+------------------------------------------------------------------------------------------------- */
 
+func walletOperationDigest(operationType string, operation WalletOperation) []byte {
+	nonce := new(big.Int).SetUint64(operation.Nonce)
+	return crypto.Keccak256(
+		crypto.Keccak256([]byte(operationType)),
+		crypto.Keccak256([]byte(operation.PublicId)),
+		crypto.Keccak256([]byte(operation.Address)),
+		common.LeftPadBytes(nonce.Bytes(), 32))
 }
 
 /* -------------------------------------------------------------------------------------------------
- getTokenHolderList: returns the balances of the holders of a token
+ addressApprovalDigest: this function computes the digest of the approval of an address of an actor
+                        by its primary address
 ------------------------------------------------------------------------------------------------- */
 
-func getTokenHolderList(stub shim.ChaincodeStubInterface, token string) ([]string, error) {
-	queryString := fmt.Sprintf(`{"selector":{"Token":"%s"}}`, token)
-	it, err := stub.GetQueryResult(queryString)
-	if err != nil {
-		return nil, errors.New("ERROR: unable to get an iterator over the balances")
+func addressApprovalDigest(operation WalletOperation) []byte {
+	nonce := new(big.Int).SetUint64(operation.Nonce)
+	return crypto.Keccak256(
+		crypto.Keccak256([]byte(APPROVE_ADDRESS_TYPE)),
+		crypto.Keccak256([]byte(operation.PublicId)),
+		crypto.Keccak256([]byte(operation.Address)),
+		crypto.Keccak256([]byte(operation.Approved)),
+		common.LeftPadBytes(nonce.Bytes(), 32))
+}
+
+/* -------------------------------------------------------------------------------------------------
+ checkWalletOperation: this function checks that an operation on a wallet address is signed by the
+                       key of the address and consumes its nonce.
+------------------------------------------------------------------------------------------------- */
+
+func checkWalletOperation(stub shim.ChaincodeStubInterface, operationType string,
+	operation WalletOperation) error {
+
+	if operation.PublicId == "" || operation.Address == "" {
+		return errors.New("ERROR: THE PUBLIC ID AND THE ADDRESS ARE REQUIRED.")
 	}
-	defer it.Close()
-	var holderList []string
-	for it.HasNext() {
-		response, error := it.Next()
-		if error != nil {
-			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
-			return nil, errors.New(message)
-		}
-		var balance Balance
-		if err = json.Unmarshal(response.Value, &balance); err != nil {
-			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
-			return nil, errors.New(message)
-		}
-		holderList = append(holderList, balance.Address)
+	digest := walletOperationDigest(operationType, operation)
+	err := validateSignature(operation.Address, digest, operation.Signature)
+	if err != nil {
+		return err
 	}
-	return holderList, nil
+	return useNonce(stub, operation.Address, operation.Nonce)
 }
 
 /* -------------------------------------------------------------------------------------------------
-findAllHoldersOfToken: returns the balances of the holders of a token
+ checkInvokedByDataProtocol: this function checks that the signed proposal of the transaction targets
+                             the Data Protocol, so that the wallet of an actor is only changed
+                             through it once it has checked the consent of the actor.
 ------------------------------------------------------------------------------------------------- */
 
-func findAllHoldersOfToken(stub shim.ChaincodeStubInterface, token string) ([]Balance, error) {
-	queryString := fmt.Sprintf(`{"selector":{"Token":"%s"}}`, token)
-	it, err := stub.GetQueryResult(queryString)
-	if err != nil {
-		return nil, errors.New("ERROR: unable to get an iterator over the balances")
+func checkInvokedByDataProtocol(stub shim.ChaincodeStubInterface, function string) error {
+
+	signedProposal, err := stub.GetSignedProposal()
+	if err != nil || signedProposal == nil {
+		return errors.New("ERROR: GETTING THE SIGNED PROPOSAL OF " + function + ".")
 	}
-	defer it.Close()
-	var balances []Balance
-	for it.HasNext() {
-		response, error := it.Next()
-		if error != nil {
-			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
-			return nil, errors.New(message)
-		}
-		var balance Balance
-		if err = json.Unmarshal(response.Value, &balance); err != nil {
-			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
-			return nil, errors.New(message)
-		}
-		balances = append(balances, balance)
+	proposal := &pb.Proposal{}
+	payload := &pb.ChaincodeProposalPayload{}
+	invocation := &pb.ChaincodeInvocationSpec{}
+	if proto.Unmarshal(signedProposal.ProposalBytes, proposal) != nil ||
+		proto.Unmarshal(proposal.Payload, payload) != nil ||
+		proto.Unmarshal(payload.Input, invocation) != nil {
+		return errors.New("ERROR: PARSING THE SIGNED PROPOSAL OF " + function + ".")
 	}
-	return balances, nil
+	target := invocation.GetChaincodeSpec().GetChaincodeId().GetName()
+	if target != DATA_PROTOCOL_CHAINCODE {
+		return errors.New("ERROR: " + function + " CAN ONLY BE INVOKED THROUGH THE " +
+			DATA_PROTOCOL_CHAINCODE + " CHAINCODE.")
+	}
+	return nil
 }
 
 /* -------------------------------------------------------------------------------------------------
-findAllBalacesOfAddress: gives the balances of a user
+generateOutput: this function generates the output and emits it as the event of the transaction.
 ------------------------------------------------------------------------------------------------- */
 
-func findAllBalacesOfAddress(stub shim.ChaincodeStubInterface, address string) ([]Balance, error) {
-	it, err := stub.GetStateByPartialCompositeKey(IndexBalances, []string{address})
+func generateOutput(stub shim.ChaincodeStubInterface, eventName string,
+	balances map[string]Balance, tokens map[string]Token,
+	transactions map[string]Transfer) pb.Response {
+
+	output := Output{UpdateBalances: balances,
+		UpdateTokens: tokens,
+		Transactions: transactions}
+	return outputResponse(stub, eventName, output)
+}
+
+/* -------------------------------------------------------------------------------------------------
+outputResponse: this function serialises an output with all its updates and emits it as the event
+                of the transaction. Fabric keeps a single event per transaction.
+------------------------------------------------------------------------------------------------- */
+
+func outputResponse(stub shim.ChaincodeStubInterface, eventName string,
+	output Output) pb.Response {
+
+	outputBytes, err := json.Marshal(output)
 	if err != nil {
-		return nil, errors.New("ERROR: unable to get an iterator over the balances")
+		return shim.Error(err.Error())
 	}
-	defer it.Close()
-	var balances []Balance
-	for it.HasNext() {
-		response, error := it.Next()
-		if error != nil {
-			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
-			return nil, errors.New(message)
-		}
-		var balance Balance
-		if err = json.Unmarshal(response.Value, &balance); err != nil {
-			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
-			return nil, errors.New(message)
-		}
-		balances = append(balances, balance)
+	err = emitEvent(stub, eventName, output)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	return balances, nil
+	return shim.Success(outputBytes)
 }
 
 /* -------------------------------------------------------------------------------------------------
-checkTokenTransferConditions: this function check if transfer with a given token are allowed
+emitEvent: this function sets the versioned event of the transaction with the updates of an output
 ------------------------------------------------------------------------------------------------- */
 
-func (t *CoinBalanceSmartContract) checkTokenTransferConditions(stub shim.ChaincodeStubInterface, tokenSymbol string,
-	date int64, amount float64) error {
+func emitEvent(stub shim.ChaincodeStubInterface, eventName string, output Output) error {
 
-	// Retrieve token //
-	token, err := t.getToken(stub, tokenSymbol)
+	timestamp, err := getTxTimestamp(stub)
 	if err != nil {
 		return err
 	}
-
-	// Get token conditions //
-	if date < token.LockUpDate {
-		return errors.New("ERROR: THE TOKEN CANNOT BE TRANSFERED YET. IT IS " +
-			" IN LOCK-UP PERIOD.")
+	event := Event{
+		Version: EVENT_VERSION, Name: eventName, TxId: stub.GetTxID(),
+		Timestamp: timestamp, Output: output}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return errors.New("ERROR: SERIALISING THE EVENT " + eventName + ". " + err.Error())
+	}
+	err = stub.SetEvent(eventName, eventBytes)
+	if err != nil {
+		return errors.New("ERROR: EMITTING THE EVENT " + eventName + ". " + err.Error())
 	}
+	return nil
+}
 
-	// Check if integer in case of NFT token //
-	if token.TokenType == NFT_POD_TOKEN {
-		if amount != math.Trunc(amount) {
+/* -------------------------------------------------------------------------------------------------
+DuplicateTransactionError: error returned when a transaction Id has already been processed.
+------------------------------------------------------------------------------------------------- */
+
+type DuplicateTransactionError struct {
+	Id string
+}
+
+func (e *DuplicateTransactionError) Error() string {
+	return "ERROR: DUPLICATE TRANSACTION. THE TRANSACTION " + e.Id +
+		" HAS ALREADY BEEN PROCESSED."
+}
+
+/* -------------------------------------------------------------------------------------------------
+errorResponse: this function generates an error response, keeping a distinct status code for
+               duplicate transactions so clients can treat resubmissions as idempotent.
+------------------------------------------------------------------------------------------------- */
+
+func errorResponse(err error) pb.Response {
+	if _, isDuplicate := err.(*DuplicateTransactionError); isDuplicate {
+		return pb.Response{Status: DUPLICATE_TRANSACTION_CODE, Message: err.Error()}
+	}
+	return shim.Error(err.Error())
+}
+
+/* -------------------------------------------------------------------------------------------------
+checkTransactionId: this function checks that a transaction Id chosen by a client does not contain
+                    the separator of the legs, so it cannot collide with the Id of a derived leg
+------------------------------------------------------------------------------------------------- */
+
+func checkTransactionId(transactionId string) error {
+	if strings.Contains(transactionId, TRANSACTION_LEG_SEPARATOR) {
+		return errors.New("ERROR: THE TRANSACTION ID " + transactionId + " CANNOT CONTAIN " +
+			TRANSACTION_LEG_SEPARATOR + ".")
+	}
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+transactionLegId: this function returns the Id of a leg derived from a transaction
+------------------------------------------------------------------------------------------------- */
+
+func transactionLegId(transactionId string, legs ...string) string {
+	return strings.Join(append([]string{transactionId}, legs...), TRANSACTION_LEG_SEPARATOR)
+}
+
+/* -------------------------------------------------------------------------------------------------
+checkTransactionNotProcessed: this function checks that a transaction Id chosen by a client is valid
+                              and was not processed before
+------------------------------------------------------------------------------------------------- */
+
+func checkTransactionNotProcessed(stub shim.ChaincodeStubInterface, transactionId string) error {
+
+	err := checkTransactionId(transactionId)
+	if err != nil {
+		return err
+	}
+	return checkTransactionLegNotProcessed(stub, transactionId)
+}
+
+/* -------------------------------------------------------------------------------------------------
+checkTransactionLegNotProcessed: this function checks that the Id of a transaction, or of a leg
+                                 derived from it, was not processed before
+------------------------------------------------------------------------------------------------- */
+
+func checkTransactionLegNotProcessed(stub shim.ChaincodeStubInterface,
+	transactionId string) error {
+
+	if transactionId == "" {
+		return errors.New("ERROR: THE TRANSACTION ID CANNOT BE EMPTY.")
+	}
+
+	// Check if transaction is already registered on Blockchain //
+	record := TransactionRecord{Transfer: Transfer{Id: transactionId}}
+	isLoaded, err := record.LoadState(stub)
+	if err != nil {
+		return errors.New("ERROR: CHECKING IF TRANSACTION IS ALREADY " +
+			"PROCESSED. " + err.Error())
+	}
+	if isLoaded {
+		return &DuplicateTransactionError{Id: transactionId}
+	}
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+addTransactionLeg: this function adds a leg derived from a transaction to the transactions of a
+                   call, rejecting legs already processed or repeated in the call
+------------------------------------------------------------------------------------------------- */
+
+func addTransactionLeg(stub shim.ChaincodeStubInterface, transactions map[string]Transfer,
+	leg Transfer) error {
+
+	if _, inBatch := transactions[leg.Id]; inBatch {
+		return &DuplicateTransactionError{Id: leg.Id}
+	}
+	err := checkTransactionLegNotProcessed(stub, leg.Id)
+	if err != nil {
+		return err
+	}
+	transactions[leg.Id] = leg
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+recordTransaction: this function stores a processed transfer with the Fabric TxID and timestamp
+------------------------------------------------------------------------------------------------- */
+
+func recordTransaction(stub shim.ChaincodeStubInterface, transfer Transfer) error {
+
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return err
+	}
+	record := TransactionRecord{
+		Transfer: transfer, TxId: stub.GetTxID(),
+		Timestamp: timestamp}
+	return record.SaveState(stub)
+}
+
+/* -------------------------------------------------------------------------------------------------
+getTxTimestamp: this function returns the timestamp in seconds of the current transaction
+------------------------------------------------------------------------------------------------- */
+
+func getTxTimestamp(stub shim.ChaincodeStubInterface) (int64, error) {
+
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return 0, errors.New("ERROR: GETTING THE TRANSACTION TIMESTAMP. " + err.Error())
+	}
+	return timestamp.Seconds, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+transferHelper: this function computes a transfer given balances and returns updated balances. The
+                sender can only spend its vested funds and overdraw into its available credit.
+                The receiver repays its outstanding credit first.
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) transferHelper(stub shim.ChaincodeStubInterface,
+	senderBalance Balance, receiverBalance Balance, amount Amount) (Balance, Balance, error) {
+
+	// Retrieve credit available for the sender //
+	status, err := getCreditStatus(stub, senderBalance)
+	if err != nil {
+		return senderBalance, receiverBalance, err
+	}
+
+	// Substract fund from sender
+	senderBalance, err = withdrawFromBalance(stub, senderBalance, amount, status.Available)
+	if err != nil {
+		return senderBalance, receiverBalance, err
+	}
+
+	// Add funds to receiver
+	receiverBalance.Amount, receiverBalance.Credit, err = saveCreditAddition(
+		receiverBalance.Amount, receiverBalance.Credit, amount)
+	if err != nil {
+		return senderBalance, receiverBalance, err
+	}
+
+	return senderBalance, receiverBalance, nil
+
+}
+
+/* -------------------------------------------------------------------------------------------------
+withdrawFromBalance: this function substracts an amount from the funds of a balance that are not
+                     locked by a vesting schedule, drawing the shortfall from the available credit
+------------------------------------------------------------------------------------------------- */
+
+func withdrawFromBalance(stub shim.ChaincodeStubInterface, balance Balance, amount Amount,
+	available Amount) (Balance, error) {
+
+	// Retrieve funds locked on the balance //
+	locked, err := getLockedAmount(stub, balance)
+	if err != nil {
+		return balance, err
+	}
+	locked = MinAmount(locked, balance.Amount)
+
+	// Substract amount from unlocked funds //
+	unlocked, credit, err := saveCreditSubstraction(
+		balance.Amount.Sub(locked), balance.Credit, available, amount)
+	if err != nil {
+		if locked.Sign() > 0 {
+			return balance, errors.New("ERROR: INSUFFICIENT UNLOCKED FUNDS ON BALANCE. " +
+				locked.String() + " " + balance.Token + " ARE STILL LOCKED BY VESTING " +
+				"OR NFT ITEMS.")
+		}
+		return balance, err
+	}
+	balance.Amount = unlocked.Add(locked)
+	balance.Credit = credit
+	return balance, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+loadFinancialScores: this function returns the financial scores of an user
+------------------------------------------------------------------------------------------------- */
+
+func loadFinancialScores(stub shim.ChaincodeStubInterface, publicId string) (FinancialScores, error) {
+
+	scores := FinancialScores{}
+	scoresBytes, err := stub.GetState(IndexFinancialScores + publicId)
+	if err != nil {
+		return scores, errors.New("ERROR: GETTING THE FINANCIAL SCORES OF THE USER")
+	}
+	if scoresBytes == nil {
+		return scores, errors.New("ERROR: THE USER " + publicId + " HAS NOT " +
+			"REGISTER FINANCIAL SCORES")
+	}
+	err = json.Unmarshal(scoresBytes, &scores)
+	return scores, err
+}
+
+/* -------------------------------------------------------------------------------------------------
+getCreditStatus: this function returns the credit line of a balance with its outstanding and
+                 available credit. The usable limit is the granted limit weighted by the
+                 TrustScore of the owner of the credit line.
+------------------------------------------------------------------------------------------------- */
+
+func getCreditStatus(stub shim.ChaincodeStubInterface, balance Balance) (CreditStatus, error) {
+
+	creditLine := CreditLine{Address: balance.Address, Token: balance.Token}
+	status := CreditStatus{
+		CreditLine: creditLine, Outstanding: balance.Credit.Add(NewAmount(0)),
+		Available: NewAmount(0)}
+
+	isLoaded, err := creditLine.LoadState(stub)
+	if err != nil {
+		return status, errors.New("ERROR: GETTING THE CREDIT LINE OF " +
+			balance.Address + ". " + err.Error())
+	}
+	if !isLoaded {
+		return status, nil
+	}
+	status.CreditLine = creditLine
+
+	scores, err := loadFinancialScores(stub, creditLine.PublicId)
+	if err != nil {
+		return status, err
+	}
+	status.TrustScore = scores.TrustScore
+	usable := creditLine.Limit.MulFloat(scores.TrustScore)
+	if usable.Cmp(balance.Credit) > 0 {
+		status.Available = usable.Sub(balance.Credit)
+	}
+	return status, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+vestedAmount: this function returns the amount of a vesting schedule released at a given timestamp
+------------------------------------------------------------------------------------------------- */
+
+func vestedAmount(schedule VestingSchedule, timestamp int64) Amount {
+
+	if schedule.Revoked || timestamp >= schedule.End {
+		return schedule.Total
+	}
+	if timestamp < schedule.Cliff || timestamp < schedule.Start {
+		return NewAmount(0)
+	}
+
+	// Release linearly or in equal steps //
+	duration := schedule.End - schedule.Start
+	elapsed := timestamp - schedule.Start
+	if schedule.Steps > 0 {
+		stepDuration := duration / int64(schedule.Steps)
+		if stepDuration == 0 {
+			return schedule.Total
+		}
+		return schedule.Total.MulDiv(elapsed/stepDuration, int64(schedule.Steps))
+	}
+	return schedule.Total.MulDiv(elapsed, duration)
+}
+
+/* -------------------------------------------------------------------------------------------------
+getVestingStatus: this function returns the vesting schedule of a balance with the locked and
+                  unlocked amounts at the timestamp of the current transaction
+------------------------------------------------------------------------------------------------- */
+
+func getVestingStatus(stub shim.ChaincodeStubInterface, address string,
+	token string) (VestingStatus, bool, error) {
+
+	schedule := VestingSchedule{Address: address, Token: token}
+	status := VestingStatus{Locked: NewAmount(0), Unlocked: NewAmount(0)}
+
+	isLoaded, err := schedule.LoadState(stub)
+	if err != nil {
+		return status, false, errors.New("ERROR: GETTING THE VESTING SCHEDULE OF " +
+			address + ". " + err.Error())
+	}
+	if !isLoaded {
+		return status, false, nil
+	}
+	status.VestingSchedule = schedule
+
+	status.Timestamp, err = getTxTimestamp(stub)
+	if err != nil {
+		return status, true, err
+	}
+	status.Unlocked = vestedAmount(schedule, status.Timestamp)
+	status.Locked = schedule.Total.Sub(status.Unlocked)
+	return status, true, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getLockedAmount: this function returns the funds of a balance still locked by a vesting schedule or
+                 backing the NFT items owned by the address
+------------------------------------------------------------------------------------------------- */
+
+func getLockedAmount(stub shim.ChaincodeStubInterface, balance Balance) (Amount, error) {
+
+	// Balances without an active schedule have no lock up date //
+	locked := NewAmount(0)
+	if balance.LockUpDate != 0 {
+		status, _, err := getVestingStatus(stub, balance.Address, balance.Token)
+		if err != nil {
+			return locked, err
+		}
+		locked = status.Locked
+	}
+
+	// Every item owned backs one whole token of the balance //
+	if balance.Items > 0 {
+		token := Token{Symbol: balance.Token}
+		_, err := token.LoadState(stub)
+		if err != nil {
+			return locked, err
+		}
+		locked = locked.Add(WholeTokens(balance.Items, token.Decimals))
+	}
+	return locked, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+createVestingSchedule: this function validates and stores the vesting schedule of the tokens granted
+                       to a balance, and sets the lock up date of the balance
+------------------------------------------------------------------------------------------------- */
+
+func createVestingSchedule(stub shim.ChaincodeStubInterface, schedule VestingSchedule,
+	balance *Balance, total Amount) error {
+
+	// Check the schedule //
+	schedule.Address = balance.Address
+	schedule.Token = balance.Token
+	schedule.Total = total
+	schedule.Revoked = false
+	if schedule.Cliff == 0 {
+		schedule.Cliff = schedule.Start
+	}
+	if schedule.End <= schedule.Start {
+		return errors.New("ERROR: THE END OF A VESTING SCHEDULE SHOULD BE AFTER ITS START.")
+	}
+	if schedule.Cliff < schedule.Start || schedule.Cliff > schedule.End {
+		return errors.New("ERROR: THE CLIFF OF A VESTING SCHEDULE SHOULD BE BETWEEN " +
+			"ITS START AND ITS END.")
+	}
+	if schedule.Steps < 0 {
+		return errors.New("ERROR: THE STEPS OF A VESTING SCHEDULE CANNOT BE NEGATIVE.")
+	}
+	if schedule.Total.Sign() <= 0 {
+		return errors.New("ERROR: THE AMOUNT OF A VESTING SCHEDULE SHOULD BE POSITIVE.")
+	}
+
+	// Only one active schedule is allowed per balance //
+	locked, err := getLockedAmount(stub, *balance)
+	if err != nil {
+		return err
+	}
+	if locked.Sign() > 0 {
+		return errors.New("ERROR: THE ADDRESS " + balance.Address + " HAS ALREADY " +
+			"AN ACTIVE VESTING SCHEDULE FOR " + balance.Token)
+	}
+
+	err = saveTokenState(stub, schedule.Token, &schedule)
+	if err != nil {
+		return err
+	}
+	balance.LockUpDate = schedule.End
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getCreditPool: this function returns a registered credit pool
+------------------------------------------------------------------------------------------------- */
+
+func getCreditPool(stub shim.ChaincodeStubInterface, poolId string) (CreditPool, error) {
+
+	pool := CreditPool{Id: poolId}
+	isLoaded, err := pool.LoadState(stub)
+	if err != nil {
+		return pool, errors.New("ERROR: GETTING THE CREDIT POOL " + poolId + ". " +
+			err.Error())
+	}
+	if !isLoaded {
+		return pool, errors.New("ERROR: THE CREDIT POOL " + poolId + " IS NOT REGISTERED.")
+	}
+	return pool, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getPoolCredits: this function returns the credit granted to an address for a token by every credit
+                pool, ordered by the Id of the pool
+------------------------------------------------------------------------------------------------- */
+
+func getPoolCredits(stub shim.ChaincodeStubInterface, address string,
+	token string) ([]PoolCredit, error) {
+	it, err := stub.GetStateByPartialCompositeKey(IndexPoolCredits, []string{address, token})
+	if err != nil {
+		return nil, errors.New("ERROR: unable to get an iterator over the pool credits")
+	}
+	defer it.Close()
+	credits := []PoolCredit{}
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return nil, errors.New(message)
+		}
+		var credit PoolCredit
+		if err = json.Unmarshal(response.Value, &credit); err != nil {
+			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
+			return nil, errors.New(message)
+		}
+		credits = append(credits, credit)
+	}
+	return credits, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+drawPoolCredit: this function returns the credit drawn from a pool to pay the needed amount and the
+                premium charged on it. The borrower owes both, so their sum cannot exceed the
+                credit left to the borrower nor the funds of the pool.
+------------------------------------------------------------------------------------------------- */
+
+func drawPoolCredit(pool CreditPool, credit PoolCredit, poolFunds Amount,
+	needed Amount) (Amount, Amount) {
+
+	capacity := MinAmount(credit.Limit.Sub(credit.Drawn), poolFunds)
+	if capacity.Sign() <= 0 {
+		return NewAmount(0), NewAmount(0)
+	}
+	draw := MinAmount(needed, capacity.MulFloat(1/(1+pool.PremiumRate)))
+	premium := draw.MulFloat(pool.PremiumRate)
+	if draw.Add(premium).Cmp(capacity) > 0 {
+		draw = capacity.Sub(premium)
+	}
+	return draw, premium
+}
+
+/* -------------------------------------------------------------------------------------------------
+getAirdrop: this function returns a published airdrop
+------------------------------------------------------------------------------------------------- */
+
+func getAirdrop(stub shim.ChaincodeStubInterface, airdropId string) (Airdrop, error) {
+
+	airdrop := Airdrop{Id: airdropId}
+	isLoaded, err := airdrop.LoadState(stub)
+	if err != nil {
+		return airdrop, errors.New("ERROR: GETTING THE AIRDROP " + airdropId + ". " +
+			err.Error())
+	}
+	if !isLoaded {
+		return airdrop, errors.New("ERROR: THE AIRDROP " + airdropId + " IS NOT PUBLISHED.")
+	}
+	return airdrop, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+ airdropLeaf: this function computes the leaf of an airdrop Merkle tree. It can be reproduced with
+              solidityKeccak256(["uint256","bytes32","uint256"], [index, keccak256(address),
+              amount]) on the client.
+------------------------------------------------------------------------------------------------- */
+
+func airdropLeaf(index uint64, address string, amount Amount) []byte {
+	indexInt := new(big.Int).SetUint64(index)
+	return crypto.Keccak256(
+		common.LeftPadBytes(indexInt.Bytes(), 32),
+		crypto.Keccak256([]byte(address)),
+		common.LeftPadBytes(amount.Int().Bytes(), 32))
+}
+
+/* -------------------------------------------------------------------------------------------------
+ verifyMerkleProof: this function checks that a leaf belongs to a Merkle tree. The pairs of nodes
+                    are sorted before being hashed, so the proof does not need the leaf position.
+------------------------------------------------------------------------------------------------- */
+
+func verifyMerkleProof(root string, leaf []byte, proof []string) (bool, error) {
+
+	rootBytes, err := hexutil.Decode(root)
+	if err != nil {
+		return false, errors.New("ERROR: ERROR DECODING THE MERKLE ROOT")
+	}
+	node := leaf
+	for _, sibling := range proof {
+		siblingBytes, err := hexutil.Decode(sibling)
+		if err != nil || len(siblingBytes) != 32 {
+			return false, errors.New("ERROR: INVALID NODE " + sibling + " IN MERKLE PROOF")
+		}
+		if bytes.Compare(node, siblingBytes) <= 0 {
+			node = crypto.Keccak256(node, siblingBytes)
+		} else {
+			node = crypto.Keccak256(siblingBytes, node)
+		}
+	}
+	return bytes.Equal(node, rootBytes), nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getClaimBitmap: this function returns the word of the claims bitmap of an airdrop holding a leaf,
+                with its bits
+------------------------------------------------------------------------------------------------- */
+
+func getClaimBitmap(stub shim.ChaincodeStubInterface, airdropId string,
+	index uint64) (ClaimBitmap, *big.Int, error) {
+
+	bitmap := ClaimBitmap{AirdropId: airdropId, Word: index / CLAIM_BITMAP_WORD_SIZE}
+	isLoaded, err := bitmap.LoadState(stub)
+	if err != nil {
+		return bitmap, nil, errors.New("ERROR: GETTING THE CLAIMS OF THE AIRDROP " +
+			airdropId + ". " + err.Error())
+	}
+	if !isLoaded {
+		return bitmap, new(big.Int), nil
+	}
+	bits, err := hexutil.DecodeBig(bitmap.Bits)
+	if err != nil {
+		return bitmap, nil, errors.New("ERROR: DECODING THE CLAIMS OF THE AIRDROP " +
+			airdropId + ". " + err.Error())
+	}
+	return bitmap, bits, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+isAirdropClaimed: this function checks if the leaf of an airdrop was already claimed
+------------------------------------------------------------------------------------------------- */
+
+func isAirdropClaimed(stub shim.ChaincodeStubInterface, airdropId string,
+	index uint64) (bool, error) {
+
+	_, bits, err := getClaimBitmap(stub, airdropId, index)
+	if err != nil {
+		return false, err
+	}
+	return bits.Bit(int(index%CLAIM_BITMAP_WORD_SIZE)) == 1, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+setAirdropClaimed: this function marks the leaf of an airdrop as claimed
+------------------------------------------------------------------------------------------------- */
+
+func setAirdropClaimed(stub shim.ChaincodeStubInterface, airdropId string, index uint64) error {
+
+	bitmap, bits, err := getClaimBitmap(stub, airdropId, index)
+	if err != nil {
+		return err
+	}
+	bits.SetBit(bits, int(index%CLAIM_BITMAP_WORD_SIZE), 1)
+	bitmap.Bits = hexutil.EncodeBig(bits)
+	return bitmap.SaveState(stub)
+}
+
+/* -------------------------------------------------------------------------------------------------
+reconcileToken: this function walks the open balances, airdrops and dividends of a token through
+                the token-first indexes and reconciles their sum with the supply of the token. The
+                holders index of the token is counted to detect holders missing from it.
+------------------------------------------------------------------------------------------------- */
+
+func reconcileToken(stub shim.ChaincodeStubInterface, token Token) (TokenAudit, error) {
+
+	audit := TokenAudit{
+		Token: token.Symbol, Supply: token.Supply, Balances: NewAmount(0),
+		Credit: NewAmount(0), Escrowed: NewAmount(0), TxId: stub.GetTxID()}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return audit, err
+	}
+	audit.Timestamp = timestamp
+
+	// Sum amount and credit of the balances of the token //
+	addressList, err := getTokenIndexKeys(stub, IndexTokenBalances, token.Symbol, 0)
+	if err != nil {
+		return audit, err
+	}
+	balances, err := loadHolderBalances(stub, token.Symbol, addressList)
+	if err != nil {
+		return audit, err
+	}
+	for _, balance := range balances {
+		audit.Balances = audit.Balances.Add(balance.Amount)
+		audit.Credit = audit.Credit.Add(balance.Credit)
+		if balance.Amount.Sign() > 0 {
+			audit.Holders++
+		}
+	}
+
+	// Count holders of the holders index //
+	holderList, err := getTokenHolderList(stub, token.Symbol)
+	if err != nil {
+		return audit, err
+	}
+	audit.IndexedHolders = len(holderList)
+
+	// Sum amounts escrowed by the open airdrops and dividends of the token //
+	escrowed, err := getEscrowedAmount(stub, token.Symbol)
+	if err != nil {
+		return audit, err
+	}
+	audit.Escrowed = escrowed
+
+	audit.Discrepancy = audit.Balances.Sub(audit.Credit).Add(audit.Escrowed).Sub(audit.Supply)
+	return audit, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getEscrowedAmount: this function returns the amount of a token escrowed by its open airdrops and by
+                   the open dividends paid in the token
+------------------------------------------------------------------------------------------------- */
+
+func getEscrowedAmount(stub shim.ChaincodeStubInterface, tokenSymbol string) (Amount, error) {
+	escrowed := NewAmount(0)
+	airdropList, err := getTokenIndexKeys(stub, IndexTokenAirdrops, tokenSymbol, 0)
+	if err != nil {
+		return escrowed, err
+	}
+	for _, airdropId := range airdropList {
+		airdrop, err := getAirdrop(stub, airdropId)
+		if err != nil {
+			return escrowed, err
+		}
+		escrowed = escrowed.Add(airdrop.Remaining)
+	}
+	dividendList, err := getTokenIndexKeys(stub, IndexTokenDividends, tokenSymbol, 0)
+	if err != nil {
+		return escrowed, err
+	}
+	for _, dividendId := range dividendList {
+		dividend := Dividend{Id: dividendId}
+		isLoaded, err := dividend.LoadState(stub)
+		if err != nil || !isLoaded {
+			return escrowed, errors.New("ERROR: LOADING THE DIVIDEND " + dividendId + ".")
+		}
+		escrowed = escrowed.Add(dividend.Remaining)
+	}
+	return escrowed, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+digestAudit: this function sets the identity of the auditor on an audit and the Keccak digest of the
+             record. The record is not signed by the contract: it is authenticated by the endorsed
+             transaction that stores it, and the digest lets off chain copies be checked against it.
+------------------------------------------------------------------------------------------------- */
+
+func digestAudit(stub shim.ChaincodeStubInterface, audit TokenAudit) (TokenAudit, error) {
+
+	var err error
+	audit.Auditor, err = cid.GetID(stub)
+	if err != nil {
+		return audit, errors.New("ERROR: GETTING THE IDENTITY OF THE AUDITOR. " + err.Error())
+	}
+	audit.AuditorMSP, err = cid.GetMSPID(stub)
+	if err != nil {
+		return audit, errors.New("ERROR: GETTING THE MSP OF THE AUDITOR. " + err.Error())
+	}
+	audit.Digest = ""
+	auditBytes, err := json.Marshal(audit)
+	if err != nil {
+		return audit, err
+	}
+	audit.Digest = hexutil.Encode(crypto.Keccak256(auditBytes))
+	return audit, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getTokenAudits: this function returns the audits of a token stored on the ledger
+------------------------------------------------------------------------------------------------- */
+
+func getTokenAudits(stub shim.ChaincodeStubInterface, tokenSymbol string) ([]TokenAudit, error) {
+	it, err := stub.GetStateByPartialCompositeKey(IndexAudits, []string{tokenSymbol})
+	if err != nil {
+		return nil, errors.New("ERROR: unable to get an iterator over the audits")
+	}
+	defer it.Close()
+	audits := []TokenAudit{}
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return nil, errors.New(message)
+		}
+		var audit TokenAudit
+		if err = json.Unmarshal(response.Value, &audit); err != nil {
+			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
+			return nil, errors.New(message)
+		}
+		audits = append(audits, audit)
+	}
+	return audits, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getIdentity: this function returns the identity of the caller as MSPID::ID
+------------------------------------------------------------------------------------------------- */
+
+func getIdentity(stub shim.ChaincodeStubInterface) (string, error) {
+
+	mspId, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", errors.New("ERROR: GETTING THE MSP OF THE CALLER. " + err.Error())
+	}
+	id, err := cid.GetID(stub)
+	if err != nil {
+		return "", errors.New("ERROR: GETTING THE IDENTITY OF THE CALLER. " + err.Error())
+	}
+	return mspId + "::" + id, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getGovernance: this function returns the governance of the smart contract and if it is set
+------------------------------------------------------------------------------------------------- */
+
+func getGovernance(stub shim.ChaincodeStubInterface) (Governance, bool, error) {
+
+	governance := Governance{}
+	governanceBytes, err := stub.GetState(IndexGovernance)
+	if err != nil {
+		return governance, false, errors.New("ERROR: GETTING THE GOVERNANCE OF THE SMART " +
+			"CONTRACT. " + err.Error())
+	}
+	if governanceBytes == nil {
+		return governance, false, nil
+	}
+	err = json.Unmarshal(governanceBytes, &governance)
+	return governance, true, err
+}
+
+/* -------------------------------------------------------------------------------------------------
+saveGovernance: this function validates and stores the approvers and threshold of the governance
+------------------------------------------------------------------------------------------------- */
+
+func saveGovernance(stub shim.ChaincodeStubInterface, governance Governance) error {
+
+	if len(governance.Approvers) == 0 {
+		return errors.New("ERROR: THE GOVERNANCE SHOULD HAVE AT LEAST ONE APPROVER.")
+	}
+	for i, approver := range governance.Approvers {
+		if approver == "" || stringInSlice(approver, governance.Approvers[:i]) {
+			return errors.New("ERROR: THE APPROVERS OF THE GOVERNANCE SHOULD BE " +
+				"DISTINCT IDENTITIES.")
+		}
+	}
+	if governance.Threshold < 1 || governance.Threshold > len(governance.Approvers) {
+		return fmt.Errorf("ERROR: THE THRESHOLD OF THE GOVERNANCE SHOULD BE BETWEEN "+
+			"1 AND %d.", len(governance.Approvers))
+	}
+	if governance.ProposalLifetime <= 0 {
+		governance.ProposalLifetime = DEFAULT_PROPOSAL_LIFETIME
+	}
+	governanceBytes, _ := json.Marshal(governance)
+	return stub.PutState(IndexGovernance, governanceBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+getApprover: this function returns the governance with the identity of the caller, which should be
+             one of its approvers
+------------------------------------------------------------------------------------------------- */
+
+func getApprover(stub shim.ChaincodeStubInterface) (Governance, string, error) {
+
+	governance, isSet, err := getGovernance(stub)
+	if err != nil {
+		return governance, "", err
+	}
+	if !isSet {
+		return governance, "", errors.New("ERROR: THE GOVERNANCE OF THE SMART CONTRACT " +
+			"IS NOT SET.")
+	}
+	identity, err := getIdentity(stub)
+	if err != nil {
+		return governance, "", err
+	}
+	if !stringInSlice(identity, governance.Approvers) {
+		return governance, "", errors.New("PERMISSION DENIED. " + identity +
+			" IS NOT AN APPROVER OF THE GOVERNANCE.")
+	}
+	return governance, identity, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getPendingProposal: this function returns a proposal that can still be approved or executed
+------------------------------------------------------------------------------------------------- */
+
+func getPendingProposal(stub shim.ChaincodeStubInterface, proposalId string) (Proposal, error) {
+
+	proposal := Proposal{Id: proposalId}
+	isLoaded, err := proposal.LoadState(stub)
+	if err != nil {
+		return proposal, errors.New("ERROR: GETTING THE PROPOSAL " + proposalId + ". " +
+			err.Error())
+	}
+	if !isLoaded {
+		return proposal, errors.New("ERROR: THE PROPOSAL " + proposalId + " DOES NOT EXIST.")
+	}
+	if proposal.Status != PROPOSAL_PENDING {
+		return proposal, errors.New("ERROR: THE PROPOSAL " + proposalId + " IS " +
+			proposal.Status + ".")
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return proposal, err
+	}
+	if timestamp >= proposal.Expiry {
+		return proposal, errors.New("ERROR: THE PROPOSAL " + proposalId + " HAS EXPIRED.")
+	}
+	return proposal, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+moveFunds: this function moves the amount of a transfer from the sender to the receiver balance.
+           Balances already modified in the call are taken from the map, which is updated.
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) moveFunds(stub shim.ChaincodeStubInterface,
+	transfer Transfer, balances map[string]Balance) error {
+
+	var err error
+
+	// Check if sender is already in transaction users list //
+	senderBalance, inList := balances[transfer.From+" "+transfer.Token]
+	if !inList {
+		senderBalance, err = t.checkBalance(stub, transfer.From, transfer.Token,
+			!transfer.AvoidCheckFrom)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check if receiver is already in transaction users list //
+	receiverBalance, inList := balances[transfer.To+" "+transfer.Token]
+	if !inList {
+		receiverBalance, err = t.checkBalance(stub, transfer.To, transfer.Token,
+			!transfer.AvoidCheckTo)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check that the sender holds the amount to send and transfer funds //
+	senderBalance, receiverBalance, err = t.transferHelper(
+		stub, senderBalance, receiverBalance, transfer.Amount)
+	if err != nil {
+		return err
+	}
+
+	balances[transfer.From+" "+transfer.Token] = senderBalance
+	balances[transfer.To+" "+transfer.Token] = receiverBalance
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+moveFundsWithoutCredit: this function moves the amount of a transfer from the unlocked funds of the
+                        sender to the receiver balance, without overdrawing the credit line of the
+                        sender. Balances already modified in the call are taken from the map.
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) moveFundsWithoutCredit(stub shim.ChaincodeStubInterface,
+	transfer Transfer, balances map[string]Balance) error {
+
+	var err error
+
+	// Retrieve sender balance and substract funds //
+	senderBalance, inList := balances[transfer.From+" "+transfer.Token]
+	if !inList {
+		senderBalance, err = t.checkBalance(stub, transfer.From, transfer.Token, true)
+		if err != nil {
+			return err
+		}
+	}
+	senderBalance, err = withdrawFromBalance(stub, senderBalance, transfer.Amount,
+		NewAmount(0))
+	if err != nil {
+		return err
+	}
+	balances[transfer.From+" "+transfer.Token] = senderBalance
+
+	// Retrieve receiver balance and add funds //
+	receiverBalance, inList := balances[transfer.To+" "+transfer.Token]
+	if !inList {
+		receiverBalance, err = t.checkBalance(stub, transfer.To, transfer.Token, true)
+		if err != nil {
+			return err
+		}
+	}
+	receiverBalance.Amount, receiverBalance.Credit, err = saveCreditAddition(
+		receiverBalance.Amount, receiverBalance.Credit, transfer.Amount)
+	if err != nil {
+		return err
+	}
+	balances[transfer.To+" "+transfer.Token] = receiverBalance
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+transferFee: this function returns the fee of a fee schedule for the amount of a transfer. The fee
+             of an NFT Pod Token is rounded down to whole tokens.
+------------------------------------------------------------------------------------------------- */
+
+func transferFee(schedule FeeSchedule, token Token, amount Amount) Amount {
+
+	percentage := amount.MulDiv(schedule.BasisPoints, BASIS_POINTS)
+	if token.TokenType == NFT_POD_TOKEN {
+		percentage = percentage.WholeFloor(token.Decimals)
+	}
+	if percentage.Cmp(schedule.MinFee) < 0 {
+		percentage = schedule.MinFee
+	}
+	if schedule.MaxFee.Sign() > 0 && percentage.Cmp(schedule.MaxFee) > 0 {
+		percentage = schedule.MaxFee
+	}
+	return schedule.FlatFee.Add(percentage)
+}
+
+/* -------------------------------------------------------------------------------------------------
+chargeTransferFee: this function charges the fee of the token of a transfer to its sender and pays
+                   it to the treasury. The fee is added to the transactions as a Transfer of Type
+                   Fee with the Id of the transfer suffixed by _fee. Only the transfers settled
+                   by an operator without the envelope of the sender can be exempted by the role
+                   of the caller, the transfers signed by their sender always pay the fee.
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) chargeTransferFee(stub shim.ChaincodeStubInterface,
+	transfer Transfer, settled bool, balances map[string]Balance,
+	transactions map[string]Transfer) error {
+
+	// Retrieve fee schedule of the token //
+	schedule := FeeSchedule{Token: transfer.Token}
+	isLoaded, err := schedule.LoadState(stub)
+	if err != nil {
+		return errors.New("ERROR: GETTING THE FEE SCHEDULE OF " + transfer.Token + ". " +
+			err.Error())
+	}
+	if !isLoaded || transfer.From == schedule.Treasury {
+		return nil
+	}
+	if settled && len(schedule.ExemptRoles) > 0 &&
+		checkAnyPermission(stub, schedule.ExemptRoles, "multitransfer") == nil {
+		return nil
+	}
+	token, err := t.getToken(stub, transfer.Token)
+	if err != nil {
+		return err
+	}
+	fee := transferFee(schedule, token, transfer.Amount)
+	if fee.Sign() <= 0 {
+		return nil
+	}
+
+	// Pay fee from sender to the treasury //
+	feeTransfer := Transfer{
+		Type: "Fee", Token: transfer.Token, From: transfer.From, To: schedule.Treasury,
+		Amount: fee, Id: transactionLegId(transfer.Id, "fee"), Date: transfer.Date}
+	err = t.moveFunds(stub, feeTransfer, balances)
+	if err != nil {
+		return errors.New("ERROR: CHARGING THE TRANSFER FEE. " + err.Error())
+	}
+	return addTransactionLeg(stub, transactions, feeTransfer)
+}
+
+/* -------------------------------------------------------------------------------------------------
+payDividend: this function pays a transfer of a dividend from its escrow to the receiver. The
+             dividend is updated in the same transaction, so its status guards against replays.
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) payDividend(stub shim.ChaincodeStubInterface,
+	transfer Transfer, balances map[string]Balance) error {
+
+	// Retrieve receiver balance and add funds //
+	var err error
+	receiverBalance, inList := balances[transfer.To+" "+transfer.Token]
+	if !inList {
+		receiverBalance, err = t.checkBalance(stub, transfer.To, transfer.Token, false)
+		if err != nil {
+			return err
+		}
+	}
+	receiverBalance.Amount, receiverBalance.Credit, err = saveCreditAddition(
+		receiverBalance.Amount, receiverBalance.Credit, transfer.Amount)
+	if err != nil {
+		return err
+	}
+	balances[transfer.To+" "+transfer.Token] = receiverBalance
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+recordDividendPayout: this function checks that a holder was not paid by a dividend yet and records
+                      its payout under the dividend
+------------------------------------------------------------------------------------------------- */
+
+func recordDividendPayout(stub shim.ChaincodeStubInterface, dividend Dividend,
+	transfer Transfer) error {
+
+	payout := DividendPayout{DividendId: dividend.Id, Address: transfer.To}
+	isLoaded, err := payout.LoadState(stub)
+	if err != nil {
+		return errors.New("ERROR: CHECKING THE PAYOUT OF THE DIVIDEND " + dividend.Id +
+			" TO " + transfer.To + ". " + err.Error())
+	}
+	if isLoaded {
+		return errors.New("ERROR: THE DIVIDEND " + dividend.Id + " WAS ALREADY PAID TO " +
+			transfer.To + ".")
+	}
+	payout.Amount = transfer.Amount
+	payout.TxId = stub.GetTxID()
+	payout.Date = transfer.Date
+	return payout.SaveState(stub)
+}
+
+/* -------------------------------------------------------------------------------------------------
+checkMaxSupply: this function checks that the supply of a token does not exceed its maximum supply.
+                A maximum supply of 0 means that the supply of the token is not capped.
+------------------------------------------------------------------------------------------------- */
+
+func checkMaxSupply(token Token) error {
+	if token.MaxSupply.Sign() < 0 {
+		return errors.New("ERROR: THE MAXIMUM SUPPLY OF A TOKEN CANNOT BE NEGATIVE.")
+	}
+	if token.MaxSupply.Sign() > 0 && token.Supply.Cmp(token.MaxSupply) > 0 {
+		return errors.New("ERROR: THE SUPPLY " + token.Supply.String() + " OF " +
+			token.Symbol + " CANNOT EXCEED ITS MAXIMUM SUPPLY OF " +
+			token.MaxSupply.String() + ".")
+	}
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+refreshMinterQuota: this function moves a minter quota to the period of a timestamp, resetting the
+                    amount minted when a new period starts, and computes the remaining quota
+------------------------------------------------------------------------------------------------- */
+
+func refreshMinterQuota(quota *MinterQuota, timestamp int64) {
+	if quota.Period > 0 && timestamp >= quota.PeriodStart+quota.Period {
+		elapsedPeriods := (timestamp - quota.PeriodStart) / quota.Period
+		quota.PeriodStart += elapsedPeriods * quota.Period
+		quota.Minted = NewAmount(0)
+	}
+	quota.Remaining = quota.Quota.Sub(quota.Minted)
+	if quota.Remaining.Sign() < 0 {
+		quota.Remaining = NewAmount(0)
+	}
+}
+
+/* -------------------------------------------------------------------------------------------------
+getMinterQuota: this function returns the quota of a minter for a token at the transaction
+                timestamp and if it is set
+------------------------------------------------------------------------------------------------- */
+
+func getMinterQuota(stub shim.ChaincodeStubInterface, minter string,
+	tokenSymbol string) (MinterQuota, bool, error) {
+
+	quota := MinterQuota{Minter: minter, Token: tokenSymbol}
+	isLoaded, err := quota.LoadState(stub)
+	if err != nil {
+		return quota, false, errors.New("ERROR: GETTING THE MINTER QUOTA OF " + minter +
+			" FOR " + tokenSymbol + ". " + err.Error())
+	}
+	if !isLoaded {
+		return quota, false, nil
+	}
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return quota, false, err
+	}
+	refreshMinterQuota(&quota, timestamp)
+	return quota, true, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getMinterQuotas: this function returns the quotas of a minter for all the tokens at the transaction
+                 timestamp
+------------------------------------------------------------------------------------------------- */
+
+func getMinterQuotas(stub shim.ChaincodeStubInterface, minter string) ([]MinterQuota, error) {
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	it, err := stub.GetStateByPartialCompositeKey(IndexMinterQuotas, []string{minter})
+	if err != nil {
+		return nil, errors.New("ERROR: unable to get an iterator over the minter quotas")
+	}
+	defer it.Close()
+	quotas := []MinterQuota{}
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return nil, errors.New(message)
+		}
+		var quota MinterQuota
+		if err = json.Unmarshal(response.Value, &quota); err != nil {
+			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
+			return nil, errors.New(message)
+		}
+		refreshMinterQuota(&quota, timestamp)
+		quotas = append(quotas, quota)
+	}
+	return quotas, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+drawMinterQuota: this function draws an amount from the quota of the caller for a token. It returns
+                 false when the caller has no quota for the token.
+------------------------------------------------------------------------------------------------- */
+
+func drawMinterQuota(stub shim.ChaincodeStubInterface, tokenSymbol string,
+	amount Amount) (MinterQuota, bool, error) {
+
+	minter, err := getIdentity(stub)
+	if err != nil {
+		return MinterQuota{}, false, err
+	}
+	quota, isMinter, err := getMinterQuota(stub, minter, tokenSymbol)
+	if err != nil || !isMinter {
+		return quota, false, err
+	}
+	if amount.Cmp(quota.Remaining) > 0 {
+		return quota, true, errors.New("ERROR: THE AMOUNT " + amount.String() +
+			" EXCEEDS THE REMAINING QUOTA " + quota.Remaining.String() + " OF THE MINTER " +
+			minter + " FOR " + tokenSymbol + ".")
+	}
+	quota.Minted = quota.Minted.Add(amount)
+	quota.Remaining = quota.Remaining.Sub(amount)
+	err = quota.SaveState(stub)
+	if err != nil {
+		return quota, true, err
+	}
+	return quota, true, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+ itemOperationDigest: this function computes the digest signed by the signer of an operation on the
+                      items of a NFT POD token
+------------------------------------------------------------------------------------------------- */
+
+func itemOperationDigest(operationType string, operation ItemOperation) []byte {
+	approved := big.NewInt(0)
+	if operation.Approved {
+		approved = big.NewInt(1)
+	}
+	nonce := new(big.Int).SetUint64(operation.Nonce)
+	return crypto.Keccak256(
+		crypto.Keccak256([]byte(operationType)),
+		crypto.Keccak256([]byte(operation.Token)),
+		crypto.Keccak256([]byte(operation.ItemId)),
+		crypto.Keccak256([]byte(operation.From)),
+		crypto.Keccak256([]byte(operation.To)),
+		common.LeftPadBytes(approved.Bytes(), 32),
+		crypto.Keccak256([]byte(operation.Signer)),
+		crypto.Keccak256([]byte(operation.Id)),
+		common.LeftPadBytes(nonce.Bytes(), 32))
+}
+
+/* -------------------------------------------------------------------------------------------------
+getItem: this function returns an item of a NFT POD token
+------------------------------------------------------------------------------------------------- */
+
+func getItem(stub shim.ChaincodeStubInterface, tokenSymbol string, itemId string) (NFTItem, error) {
+
+	item := NFTItem{Token: tokenSymbol, ItemId: itemId}
+	isLoaded, err := item.LoadState(stub)
+	if err != nil {
+		return item, errors.New("ERROR: GETTING THE ITEM " + itemId + " OF " + tokenSymbol +
+			". " + err.Error())
+	}
+	if !isLoaded {
+		return item, errors.New("ERROR: THE ITEM " + itemId + " OF " + tokenSymbol +
+			" DOES NOT EXIST.")
+	}
+	return item, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+updateItemOwnerIndex: this function moves an item from the owner index of its previous owner to the
+                      one of its current owner
+------------------------------------------------------------------------------------------------- */
+
+func updateItemOwnerIndex(stub shim.ChaincodeStubInterface, item NFTItem,
+	previousOwner string) error {
+
+	if previousOwner != "" {
+		previousKey, err := stub.CreateCompositeKey(IndexItemOwners,
+			[]string{item.Token, previousOwner, item.ItemId})
+		if err != nil {
+			return errors.New("ERROR: CREATING THE ITEM OWNER KEY. " + err.Error())
+		}
+		err = stub.DelState(previousKey)
+		if err != nil {
+			return errors.New("ERROR: DELETING THE ITEM OWNER KEY. " + err.Error())
+		}
+	}
+	ownerKey, err := stub.CreateCompositeKey(IndexItemOwners,
+		[]string{item.Token, item.Owner, item.ItemId})
+	if err != nil {
+		return errors.New("ERROR: CREATING THE ITEM OWNER KEY. " + err.Error())
+	}
+	return stub.PutState(ownerKey, []byte{0x00})
+}
+
+/* -------------------------------------------------------------------------------------------------
+isItemOperator: this function returns if an operator can manage all the items of a token of an owner
+------------------------------------------------------------------------------------------------- */
+
+func isItemOperator(stub shim.ChaincodeStubInterface, owner string, tokenSymbol string,
+	operator string) (bool, error) {
+
+	itemOperator := ItemOperator{Owner: owner, Token: tokenSymbol, Operator: operator}
+	isLoaded, err := itemOperator.LoadState(stub)
+	if err != nil {
+		return false, errors.New("ERROR: GETTING THE OPERATOR " + operator + " OF " + owner +
+			". " + err.Error())
+	}
+	return isLoaded && itemOperator.Approved, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+checkItemOperation: this function checks that an operation on an item is signed by its owner, by the
+                    address approved for the item (only for transfers) or by an operator of the
+                    owner, and consumes the nonce of the signer.
+------------------------------------------------------------------------------------------------- */
+
+func checkItemOperation(stub shim.ChaincodeStubInterface, operationType string,
+	operation ItemOperation, signature string, item NFTItem) error {
+
+	if operation.From != item.Owner {
+		return errors.New("ERROR: THE ITEM " + item.ItemId + " OF " + item.Token +
+			" IS NOT OWNED BY " + operation.From + ".")
+	}
+	if operation.Signer == "" {
+		operation.Signer = operation.From
+	}
+
+	// Check that the signer can manage the item //
+	allowed := operation.Signer == item.Owner ||
+		(operationType == TRANSFER_ITEM_TYPE && operation.Signer == item.Approved)
+	if !allowed {
+		isOperator, err := isItemOperator(stub, item.Owner, item.Token, operation.Signer)
+		if err != nil {
+			return err
+		}
+		if !isOperator {
+			return errors.New("ERROR: " + operation.Signer + " IS NOT ALLOWED TO MANAGE THE " +
+				"ITEM " + item.ItemId + " OF " + item.Token + ".")
+		}
+	}
+
+	// Validate signature of the signer and consume its nonce //
+	err := validateSignature(operation.Signer, itemOperationDigest(operationType, operation),
+		signature)
+	if err != nil {
+		return err
+	}
+	return useNonce(stub, operation.Signer, operation.Nonce)
+}
+
+/* -------------------------------------------------------------------------------------------------
+getItemsOfOwnerPage: this function returns a page of the items of a token owned by an address in
+                     item order from the owner index
+------------------------------------------------------------------------------------------------- */
+
+func getItemsOfOwnerPage(stub shim.ChaincodeStubInterface, tokenSymbol string, owner string,
+	pageQuery PageQuery) ([]NFTItem, QueryPage, error) {
+
+	page := QueryPage{}
+	if pageQuery.PageSize <= 0 {
+		pageQuery.PageSize = DEFAULT_PAGE_SIZE
+	}
+	if pageQuery.PageSize > MAX_PAGE_SIZE {
+		pageQuery.PageSize = MAX_PAGE_SIZE
+	}
+
+	it, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(IndexItemOwners,
+		[]string{tokenSymbol, owner}, pageQuery.PageSize, pageQuery.Bookmark)
+	if err != nil {
+		return nil, page, errors.New("ERROR: unable to get an iterator over the items. " +
+			err.Error())
+	}
+	defer it.Close()
+	items := []NFTItem{}
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return nil, page, errors.New(message)
+		}
+		_, keys, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("ERROR: unable to split the item key: %s", err.Error())
+			return nil, page, errors.New(message)
+		}
+		item, err := getItem(stub, tokenSymbol, keys[2])
+		if err != nil {
+			return nil, page, err
+		}
+		items = append(items, item)
+	}
+	page.FetchedRecordsCount = metadata.FetchedRecordsCount
+	page.Bookmark = metadata.Bookmark
+	return items, page, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getBalanceHistory: this function returns a page of the changes of a balance between two timestamps.
+                   Changes are returned in ledger order and the bookmark is the TxID of the last
+                   change of the page.
+------------------------------------------------------------------------------------------------- */
+
+func getBalanceHistory(stub shim.ChaincodeStubInterface, history History) (HistoryPage, error) {
+
+	page := HistoryPage{Changes: []BalanceChange{}}
+	balance := Balance{Address: history.Address, Token: history.Token}
+	compositeKey, err := balance.ToCompositeKey(stub)
+	if err != nil {
+		return page, err
+	}
+
+	// Retrieve iterator of History for the balance //
+	resultsIterator, err := stub.GetHistoryForKey(compositeKey)
+	if err != nil {
+		return page, errors.New("ERROR: RETRIEVING THE HISTORY FROM BLOCKCHAIN. " +
+			"ERROR WAS: " + err.Error())
+	}
+	defer resultsIterator.Close()
+
+	// Walk the whole history to compute previous amounts, keep changes of the page //
+	previousAmount := NewAmount(0)
+	started := history.Bookmark == ""
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return page, errors.New("ERROR: GETTING NEXT ITERATOR. " +
+				"ERROR WAS: " + err.Error())
+		}
+		change := BalanceChange{
+			TxId: response.TxId, Timestamp: response.Timestamp.Seconds,
+			PreviousAmount: previousAmount, NewAmount: NewAmount(0),
+			IsDelete: response.IsDelete}
+		if !response.IsDelete {
+			value := Balance{}
+			err = value.FromLedgerValue(response.Value)
+			if err != nil {
+				return page, errors.New("ERROR: PARSING THE HISTORY OF THE BALANCE. " +
+					err.Error())
+			}
+			change.NewAmount = value.Amount
+		}
+		previousAmount = change.NewAmount
+
+		// Skip changes up to the bookmark and out of the time range //
+		if !started {
+			started = response.TxId == history.Bookmark
+			continue
+		}
+		if change.Timestamp < history.FromTimestamp ||
+			(history.ToTimestamp != 0 && change.Timestamp > history.ToTimestamp) {
+			continue
+		}
+		if len(page.Changes) == history.PageSize {
+			page.Bookmark = page.Changes[len(page.Changes)-1].TxId
+			break
+		}
+		page.Changes = append(page.Changes, change)
+	}
+	if !started {
+		return page, errors.New("ERROR: INVALID BOOKMARK " + history.Bookmark)
+	}
+	return page, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getAllowance: this function returns the allowance of a spender over the tokens of an owner
+------------------------------------------------------------------------------------------------- */
+
+func getAllowance(stub shim.ChaincodeStubInterface, owner string, spender string,
+	token string) (Allowance, error) {
+
+	allowance := Allowance{Owner: owner, Spender: spender, Token: token}
+	isLoaded, err := allowance.LoadState(stub)
+	if err != nil {
+		return allowance, errors.New("ERROR: GETTING THE ALLOWANCE OF " + spender +
+			" OVER " + owner + ". " + err.Error())
+	}
+	if !isLoaded {
+		allowance.Amount = NewAmount(0)
+	}
+	return allowance, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+ getTokenHolderList: returns the addresses of the holders of a token from the holders index
+------------------------------------------------------------------------------------------------- */
+
+func getTokenHolderList(stub shim.ChaincodeStubInterface, token string) ([]string, error) {
+	it, err := stub.GetStateByPartialCompositeKey(IndexHolders, []string{token})
+	if err != nil {
+		return nil, errors.New("ERROR: unable to get an iterator over the holders")
+	}
+	defer it.Close()
+	var holderList []string
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return nil, errors.New(message)
+		}
+		_, keys, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("ERROR: unable to split the holder key: %s", err.Error())
+			return nil, errors.New(message)
+		}
+		holderList = append(holderList, keys[1])
+	}
+	return holderList, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getTokenHoldersAfter: returns up to pageSize holders of a token in address order after a cursor
+                      address, and if more holders are left. The holders are iterated without
+                      pagination, which is not supported in write transactions, and the iteration
+                      stops as soon as the page is full.
+------------------------------------------------------------------------------------------------- */
+
+func getTokenHoldersAfter(stub shim.ChaincodeStubInterface, token string, cursor string,
+	pageSize int) ([]string, bool, error) {
+	it, err := stub.GetStateByPartialCompositeKey(IndexHolders, []string{token})
+	if err != nil {
+		return nil, false, errors.New("ERROR: unable to get an iterator over the holders")
+	}
+	defer it.Close()
+	holderList := []string{}
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return nil, false, errors.New(message)
+		}
+		_, keys, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("ERROR: unable to split the holder key: %s", err.Error())
+			return nil, false, errors.New(message)
+		}
+		if cursor != "" && keys[1] <= cursor {
+			continue
+		}
+		if len(holderList) == pageSize {
+			return holderList, true, nil
+		}
+		holderList = append(holderList, keys[1])
+	}
+	return holderList, false, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+findAllHoldersOfToken: returns the balances of the holders of a token
+------------------------------------------------------------------------------------------------- */
+
+func findAllHoldersOfToken(stub shim.ChaincodeStubInterface, token string) ([]Balance, error) {
+	holderList, err := getTokenHolderList(stub, token)
+	if err != nil {
+		return nil, err
+	}
+	return loadHolderBalances(stub, token, holderList)
+}
+
+/* -------------------------------------------------------------------------------------------------
+loadHolderBalances: returns the balances of a list of holders of a token
+------------------------------------------------------------------------------------------------- */
+
+func loadHolderBalances(stub shim.ChaincodeStubInterface, token string,
+	holderList []string) ([]Balance, error) {
+	balances := []Balance{}
+	for _, address := range holderList {
+		balance := Balance{Address: address, Token: token}
+		if _, err := balance.LoadState(stub); err != nil {
+			message := fmt.Sprintf("ERROR: unable to load the balance of %s: %s",
+				address, err.Error())
+			return nil, errors.New(message)
+		}
+		balances = append(balances, balance)
+	}
+	return balances, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+updateHolderIndex: this function adds the holder of a balance to the holders index of the token
+                   when the balance becomes positive and removes it when the balance becomes zero
+------------------------------------------------------------------------------------------------- */
+
+func updateHolderIndex(stub shim.ChaincodeStubInterface, balance Balance) error {
+	holderKey, err := stub.CreateCompositeKey(IndexHolders,
+		[]string{balance.Token, balance.Address})
+	if err != nil {
+		return errors.New("ERROR: CREATING THE HOLDER KEY. " + err.Error())
+	}
+	indexed, err := stub.GetState(holderKey)
+	if err != nil {
+		return errors.New("ERROR: READING THE HOLDER KEY. " + err.Error())
+	}
+
+	// Write only when the balance changes from or to zero //
+	isHolder := balance.Amount.Sign() > 0
+	if isHolder && indexed == nil {
+		return stub.PutState(holderKey, []byte{0x00})
+	}
+	if !isHolder && indexed != nil {
+		return stub.DelState(holderKey)
+	}
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+updateTokenIndex: this function keeps a key of a token-first index while the state it points to is
+                  open (a balance with funds or credit, an escrow with funds left), so that the
+                  states of a token can be walked without reading the states of the other tokens
+------------------------------------------------------------------------------------------------- */
+
+func updateTokenIndex(stub shim.ChaincodeStubInterface, index string, token string, key string,
+	isOpen bool) error {
+	indexKey, err := stub.CreateCompositeKey(index, []string{token, key})
+	if err != nil {
+		return errors.New("ERROR: CREATING THE " + index + " KEY. " + err.Error())
+	}
+	indexed, err := stub.GetState(indexKey)
+	if err != nil {
+		return errors.New("ERROR: READING THE " + index + " KEY. " + err.Error())
+	}
+	if isOpen && indexed == nil {
+		return stub.PutState(indexKey, []byte{0x00})
+	}
+	if !isOpen && indexed != nil {
+		return stub.DelState(indexKey)
+	}
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getTokenIndexKeys: this function returns the first pageSize keys of a token in a token-first index,
+                   or all of them when pageSize is 0
+------------------------------------------------------------------------------------------------- */
+
+func getTokenIndexKeys(stub shim.ChaincodeStubInterface, index string, token string,
+	pageSize int) ([]string, error) {
+	it, err := stub.GetStateByPartialCompositeKey(index, []string{token})
+	if err != nil {
+		return nil, errors.New("ERROR: unable to get an iterator over " + index)
+	}
+	defer it.Close()
+	keyList := []string{}
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return nil, errors.New(message)
+		}
+		_, keys, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("ERROR: unable to split the %s key: %s", index, err.Error())
+			return nil, errors.New(message)
+		}
+		keyList = append(keyList, keys[1])
+		if len(keyList) == pageSize {
+			break
+		}
+	}
+	return keyList, nil
+}
+
+// Definition of a state stored under the symbol of a token, cleared when the token is archived //
+type tokenState interface {
+	ToCompositeKey(stub shim.ChaincodeStubInterface) (string, error)
+	SaveState(stub shim.ChaincodeStubInterface) error
+}
+
+/* -------------------------------------------------------------------------------------------------
+saveTokenState: this function stores a state of a token and indexes its key under the token, so that
+                it does not carry over to a new token registered with the symbol once archived
+------------------------------------------------------------------------------------------------- */
+
+func saveTokenState(stub shim.ChaincodeStubInterface, tokenSymbol string, state tokenState) error {
+	if err := state.SaveState(stub); err != nil {
+		return err
+	}
+	compositeKey, err := state.ToCompositeKey(stub)
+	if err != nil {
+		return err
+	}
+	objectType, attributes, err := stub.SplitCompositeKey(compositeKey)
+	if err != nil {
+		return errors.New("ERROR: SPLITTING THE KEY OF THE STATE. " + err.Error())
+	}
+	indexKey, err := stub.CreateCompositeKey(IndexTokenStates,
+		append([]string{tokenSymbol, objectType}, attributes...))
+	if err != nil {
+		return errors.New("ERROR: CREATING THE TOKEN STATE KEY. " + err.Error())
+	}
+	return stub.PutState(indexKey, []byte{0x00})
+}
+
+/* -------------------------------------------------------------------------------------------------
+clearHolderStates: this function deletes the states of a redeemed holder of a token: its vesting
+                   schedule, its credit line, the allowances it granted and its item operators
+------------------------------------------------------------------------------------------------- */
+
+func clearHolderStates(stub shim.ChaincodeStubInterface, address string, tokenSymbol string) error {
+	schedule := VestingSchedule{Address: address, Token: tokenSymbol}
+	creditLine := CreditLine{Address: address, Token: tokenSymbol}
+	for _, state := range []tokenState{&schedule, &creditLine} {
+		stateKey, err := state.ToCompositeKey(stub)
+		if err != nil {
+			return err
+		}
+		if err = stub.DelState(stateKey); err != nil {
+			return err
+		}
+	}
+
+	// Allowances are keyed by owner, spender and token //
+	err := deleteStatesByPartialKey(stub, IndexAllowances, []string{address}, tokenSymbol)
+	if err != nil {
+		return err
+	}
+	return deleteStatesByPartialKey(stub, IndexItemOperators, []string{address, tokenSymbol}, "")
+}
+
+/* -------------------------------------------------------------------------------------------------
+deleteStatesByPartialKey: this function deletes the states of an index matching a partial key, and
+                          ending with a given attribute when it is not empty
+------------------------------------------------------------------------------------------------- */
+
+func deleteStatesByPartialKey(stub shim.ChaincodeStubInterface, index string,
+	attributes []string, lastAttribute string) error {
+	it, err := stub.GetStateByPartialCompositeKey(index, attributes)
+	if err != nil {
+		return errors.New("ERROR: unable to get an iterator over " + index)
+	}
+	defer it.Close()
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return errors.New(message)
+		}
+		_, keys, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("ERROR: unable to split the %s key: %s", index, err.Error())
+			return errors.New(message)
+		}
+		if lastAttribute != "" && keys[len(keys)-1] != lastAttribute {
+			continue
+		}
+		if err = stub.DelState(response.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+clearTokenStates: this function deletes the states stored under the symbol of an archived token
+                  (allowances, credit lines, vesting and fee schedules, minter quotas and items)
+------------------------------------------------------------------------------------------------- */
+
+func clearTokenStates(stub shim.ChaincodeStubInterface, tokenSymbol string) error {
+	it, err := stub.GetStateByPartialCompositeKey(IndexTokenStates, []string{tokenSymbol})
+	if err != nil {
+		return errors.New("ERROR: unable to get an iterator over the token states")
+	}
+	defer it.Close()
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return errors.New(message)
+		}
+		_, keys, err := stub.SplitCompositeKey(response.Key)
+		if err != nil || len(keys) < 2 {
+			return errors.New("ERROR: INVALID TOKEN STATE KEY " + response.Key)
+		}
+		stateKey, err := stub.CreateCompositeKey(keys[1], keys[2:])
+		if err != nil {
+			return errors.New("ERROR: CREATING THE KEY OF THE STATE. " + err.Error())
+		}
+		if err = stub.DelState(stateKey); err != nil {
+			return err
+		}
+		if err = stub.DelState(response.Key); err != nil {
+			return err
+		}
+	}
+
+	// Remove the items from the owners index //
+	return deleteStatesByPartialKey(stub, IndexItemOwners, []string{tokenSymbol}, "")
+}
+
+/* -------------------------------------------------------------------------------------------------
+saveAirdrop: this function stores an airdrop and keeps it in the index of the open airdrops of its
+             token while it escrows funds
+------------------------------------------------------------------------------------------------- */
+
+func saveAirdrop(stub shim.ChaincodeStubInterface, airdrop Airdrop) error {
+	if err := airdrop.SaveState(stub); err != nil {
+		return err
+	}
+	return updateTokenIndex(stub, IndexTokenAirdrops, airdrop.Token, airdrop.Id,
+		airdrop.Remaining.Sign() > 0)
+}
+
+/* -------------------------------------------------------------------------------------------------
+saveDividend: this function stores a dividend and keeps it in the index of the open dividends of its
+              payout token while it escrows funds
+------------------------------------------------------------------------------------------------- */
+
+func saveDividend(stub shim.ChaincodeStubInterface, dividend Dividend) error {
+	if err := dividend.SaveState(stub); err != nil {
+		return err
+	}
+	return updateTokenIndex(stub, IndexTokenDividends, dividend.PayoutToken, dividend.Id,
+		dividend.Remaining.Sign() > 0)
+}
+
+/* -------------------------------------------------------------------------------------------------
+migrateStates: this function rewrites a batch of MAX_PAGE_SIZE states of an iterator with a
+               migration. States are walked in key order and the batch resumes after the bookmark,
+               which is the last key migrated by the previous batch. The bookmark of the result is
+               empty once all the states are migrated.
+------------------------------------------------------------------------------------------------- */
+
+func migrateStates(it shim.StateQueryIteratorInterface, page MigrationPage,
+	migrate func(key string, value []byte) error) (MigrationPage, error) {
+
+	defer it.Close()
+	bookmark := page.Bookmark
+	page.Bookmark = ""
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", err.Error())
+			return page, errors.New(message)
+		}
+		if bookmark != "" && response.Key <= bookmark {
+			continue
+		}
+		if page.Migrated == MAX_PAGE_SIZE {
+			page.Bookmark = bookmark
+			return page, nil
+		}
+		err = migrate(response.Key, response.Value)
+		if err != nil {
+			return page, errors.New("ERROR: MIGRATING STATE " + response.Key + ". " +
+				err.Error())
+		}
+		page.Migrated++
+		bookmark = response.Key
+	}
+	return page, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getQueryResultPage: this function runs a paginated rich query with a selector, sorted by one of the
+                    supported sort fields. Each sort field maps to the fields of its CouchDB index.
+------------------------------------------------------------------------------------------------- */
+
+func getQueryResultPage(stub shim.ChaincodeStubInterface, selector map[string]interface{},
+	pageQuery PageQuery, sortFields map[string][]string) ([][]byte, QueryPage, error) {
+
+	page := QueryPage{}
+	query := map[string]interface{}{"selector": selector}
+
+	// Sort by the fields of the index of the sort field //
+	if pageQuery.SortBy != "" {
+		indexFields, ok := sortFields[pageQuery.SortBy]
+		if !ok {
+			return nil, page, errors.New("ERROR: SORTING BY " + pageQuery.SortBy +
+				" IS NOT SUPPORTED.")
+		}
+		if pageQuery.SortOrder == "" {
+			pageQuery.SortOrder = SORT_ASC
+		}
+		if pageQuery.SortOrder != SORT_ASC && pageQuery.SortOrder != SORT_DESC {
+			return nil, page, errors.New("ERROR: SORT ORDER SHOULD BE " + SORT_ASC +
+				" OR " + SORT_DESC + ".")
+		}
+		var sort []map[string]string
+		for _, field := range indexFields {
+			if _, inSelector := selector[field]; !inSelector {
+				selector[field] = map[string]interface{}{"$gt": nil}
+			}
+			sort = append(sort, map[string]string{field: pageQuery.SortOrder})
+		}
+		query["sort"] = sort
+	}
+	queryBytes, err := json.Marshal(query)
+	if err != nil {
+		return nil, page, err
+	}
+
+	// Limit size of the page //
+	if pageQuery.PageSize <= 0 {
+		pageQuery.PageSize = DEFAULT_PAGE_SIZE
+	}
+	if pageQuery.PageSize > MAX_PAGE_SIZE {
+		pageQuery.PageSize = MAX_PAGE_SIZE
+	}
+
+	it, metadata, err := stub.GetQueryResultWithPagination(string(queryBytes),
+		pageQuery.PageSize, pageQuery.Bookmark)
+	if err != nil {
+		return nil, page, errors.New("ERROR: unable to get an iterator over the query. " +
+			err.Error())
+	}
+	defer it.Close()
+	var values [][]byte
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return nil, page, errors.New(message)
+		}
+		values = append(values, response.Value)
+	}
+	page.FetchedRecordsCount = metadata.FetchedRecordsCount
+	page.Bookmark = metadata.Bookmark
+	return values, page, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+findHoldersOfTokenPage: this function returns a page of the balances of the holders of a token.
+                        Sorting by Amount or by descending Address needs a CouchDB rich query.
+------------------------------------------------------------------------------------------------- */
+
+func findHoldersOfTokenPage(stub shim.ChaincodeStubInterface, token string,
+	pageQuery PageQuery) ([]Balance, QueryPage, error) {
+
+	// Pages in address order are read from the holders index //
+	if pageQuery.SortBy == "" || (pageQuery.SortBy == "Address" && pageQuery.SortOrder != SORT_DESC) {
+		return findHoldersOfTokenIndexPage(stub, token, pageQuery)
+	}
+
+	selector := map[string]interface{}{"docType": DOC_TYPE_BALANCE, "Token": token}
+	sortFields := map[string][]string{
+		"Amount":  {"docType", "Token", "AmountKey"},
+		"Address": {"docType", "Token", "Address"}}
+	values, page, err := getQueryResultPage(stub, selector, pageQuery, sortFields)
+	if err != nil {
+		return nil, page, err
+	}
+	balances := []Balance{}
+	for _, value := range values {
+		var balance Balance
+		if err = balance.FromLedgerValue(value); err != nil {
+			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
+			return nil, page, errors.New(message)
+		}
+		balances = append(balances, balance)
+	}
+	return balances, page, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+findHoldersOfTokenIndexPage: this function returns a page of the balances of the holders of a token
+                             in address order from the holders index
+------------------------------------------------------------------------------------------------- */
+
+func findHoldersOfTokenIndexPage(stub shim.ChaincodeStubInterface, token string,
+	pageQuery PageQuery) ([]Balance, QueryPage, error) {
+
+	page := QueryPage{}
+	if pageQuery.PageSize <= 0 {
+		pageQuery.PageSize = DEFAULT_PAGE_SIZE
+	}
+	if pageQuery.PageSize > MAX_PAGE_SIZE {
+		pageQuery.PageSize = MAX_PAGE_SIZE
+	}
+
+	it, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(IndexHolders,
+		[]string{token}, pageQuery.PageSize, pageQuery.Bookmark)
+	if err != nil {
+		return nil, page, errors.New("ERROR: unable to get an iterator over the holders. " +
+			err.Error())
+	}
+	defer it.Close()
+	var holderList []string
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return nil, page, errors.New(message)
+		}
+		_, keys, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			message := fmt.Sprintf("ERROR: unable to split the holder key: %s", err.Error())
+			return nil, page, errors.New(message)
+		}
+		holderList = append(holderList, keys[1])
+	}
+	page.FetchedRecordsCount = metadata.FetchedRecordsCount
+	page.Bookmark = metadata.Bookmark
+
+	balances, err := loadHolderBalances(stub, token, holderList)
+	return balances, page, err
+}
+
+/* -------------------------------------------------------------------------------------------------
+findTokensByTypePage: this function returns a page of the tokens of a given type
+------------------------------------------------------------------------------------------------- */
+
+func findTokensByTypePage(stub shim.ChaincodeStubInterface, tokenType string,
+	pageQuery PageQuery) ([]Token, QueryPage, error) {
+
+	selector := map[string]interface{}{"docType": DOC_TYPE_TOKEN, "TokenType": tokenType}
+	sortFields := map[string][]string{
+		"Symbol": {"docType", "TokenType", "Symbol"},
+		"Name":   {"docType", "TokenType", "Name"}}
+	values, page, err := getQueryResultPage(stub, selector, pageQuery, sortFields)
+	if err != nil {
+		return nil, page, err
+	}
+	tokens := []Token{}
+	for _, value := range values {
+		var token Token
+		if err = token.FromLedgerValue(value); err != nil {
+			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
+			return nil, page, errors.New(message)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, page, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+findAllBalacesOfAddress: gives the balances of a user
+------------------------------------------------------------------------------------------------- */
+
+func findAllBalacesOfAddress(stub shim.ChaincodeStubInterface, address string) ([]Balance, error) {
+	it, err := stub.GetStateByPartialCompositeKey(IndexBalances, []string{address})
+	if err != nil {
+		return nil, errors.New("ERROR: unable to get an iterator over the balances")
+	}
+	defer it.Close()
+	var balances []Balance
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return nil, errors.New(message)
+		}
+		var balance Balance
+		if err = balance.FromLedgerValue(response.Value); err != nil {
+			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
+			return nil, errors.New(message)
+		}
+		balances = append(balances, balance)
+	}
+	return balances, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+checkTokenTransferConditions: this function check if transfer with a given token are allowed. Amounts
+                              received as decimal numbers are converted to base units of the token
+                              and the transfer is dated with the transaction timestamp.
+------------------------------------------------------------------------------------------------- */
+
+func (t *CoinBalanceSmartContract) checkTokenTransferConditions(stub shim.ChaincodeStubInterface,
+	transfer *Transfer) error {
+
+	// Retrieve token //
+	token, err := t.getToken(stub, transfer.Token)
+	if err != nil {
+		return err
+	}
+
+	// Transfers are only allowed on active tokens //
+	err = checkTokenStatus(token, TOKEN_ACTIVE)
+	if err != nil {
+		return err
+	}
+
+	// Convert amount to base units of the token //
+	err = transfer.Amount.Resolve(token.Decimals)
+	if err != nil {
+		return err
+	}
+	if transfer.Amount.Sign() < 0 {
+		return errors.New("ERROR: NEGATIVE AMOUNTS ARE NOT ALLOWED")
+	}
+
+	// Date transfer with the transaction timestamp //
+	err = stampTransferDate(stub, transfer)
+	if err != nil {
+		return err
+	}
+
+	// Get token conditions //
+	if transfer.Date < token.LockUpDate {
+		return errors.New("ERROR: THE TOKEN CANNOT BE TRANSFERED YET. IT IS " +
+			" IN LOCK-UP PERIOD.")
+	}
+
+	// Check if integer in case of NFT token //
+	if token.TokenType == NFT_POD_TOKEN {
+		if !transfer.Amount.IsWhole(token.Decimals) {
 			return errors.New("ERROR: THE TRANSFER AMOUNT FOR A NFT POD TOKEN " +
 				" SHOULD BE AN INTEGER.")
 		}
 	}
 	return nil
 }
+
+/* -------------------------------------------------------------------------------------------------
+stampTransferDate: this function sets the date of a transfer to the transaction timestamp. The date
+                   sent by the client is kept as ClientDate and is rejected when it differs from
+                   the transaction timestamp by more than the configured skew.
+------------------------------------------------------------------------------------------------- */
+
+func stampTransferDate(stub shim.ChaincodeStubInterface, transfer *Transfer) error {
+
+	timestamp, err := getTxTimestamp(stub)
+	if err != nil {
+		return err
+	}
+
+	// Check client date against the transaction timestamp //
+	if transfer.Date != 0 {
+		config, err := getConfig(stub)
+		if err != nil {
+			return err
+		}
+		skew := transfer.Date - timestamp
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > config.MaxDateSkew {
+			return errors.New(fmt.Sprintf("ERROR: THE DATE %d OF THE TRANSFER IS MORE THAN "+
+				"%d SECONDS AWAY FROM THE TRANSACTION TIMESTAMP %d.",
+				transfer.Date, config.MaxDateSkew, timestamp))
+		}
+	}
+	transfer.ClientDate = transfer.Date
+	transfer.Date = timestamp
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+getConfig: this function returns the configuration of the smart contract with its default values
+------------------------------------------------------------------------------------------------- */
+
+func getConfig(stub shim.ChaincodeStubInterface) (Config, error) {
+
+	config := Config{MaxDateSkew: DEFAULT_MAX_DATE_SKEW}
+	configBytes, err := stub.GetState(IndexConfig)
+	if err != nil {
+		return config, errors.New("ERROR: GETTING THE CONFIGURATION OF THE SMART " +
+			"CONTRACT. " + err.Error())
+	}
+	if configBytes == nil {
+		return config, nil
+	}
+	err = json.Unmarshal(configBytes, &config)
+	return config, err
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const testPrivateKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+const testOtherPrivateKey = "8da4ef21b864d2cc526dbdb2a120bd2874c36c9d0a1fb7f8c63d7f7a8b41de8f"
+
+func testTransfer() Transfer {
+	return Transfer{
+		Token: "PRIVI", From: "0xFrom", To: "0xTo", Amount: NewAmount(150000000),
+		Id: "tx1", Nonce: 3}
+}
+
+func signDigest(t *testing.T, privateKey string, digest []byte) []byte {
+	key, err := crypto.HexToECDSA(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := crypto.Sign(signedMessageHash(digest), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+func keyAddress(t *testing.T, privateKey string) string {
+	key, err := crypto.HexToECDSA(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crypto.PubkeyToAddress(key.PublicKey).Hex()
+}
+
+func TestTransferDigest(t *testing.T) {
+	base := transferDigest(testTransfer())
+	if !bytes.Equal(base, transferDigest(testTransfer())) {
+		t.Fatal("the digest of a transfer should be deterministic")
+	}
+
+	tests := []struct {
+		name   string
+		change func(*Transfer)
+	}{
+		{"token", func(transfer *Transfer) { transfer.Token = "BC" }},
+		{"from", func(transfer *Transfer) { transfer.From = "0xOther" }},
+		{"to", func(transfer *Transfer) { transfer.To = "0xOther" }},
+		{"amount", func(transfer *Transfer) { transfer.Amount = NewAmount(150000001) }},
+		{"id", func(transfer *Transfer) { transfer.Id = "tx2" }},
+		{"nonce", func(transfer *Transfer) { transfer.Nonce = 4 }},
+		{"field boundaries", func(transfer *Transfer) {
+			transfer.From, transfer.To = "0xFrom0xTo", ""
+		}},
+	}
+	for _, test := range tests {
+		transfer := testTransfer()
+		test.change(&transfer)
+		if bytes.Equal(base, transferDigest(transfer)) {
+			t.Errorf("%s: changing the transfer should change its digest", test.name)
+		}
+	}
+	if bytes.Equal(base, typedTransferDigest(APPROVE_TYPE, testTransfer())) {
+		t.Error("the digest should depend on the operation type")
+	}
+}
+
+func TestValidateSignature(t *testing.T) {
+	address := keyAddress(t, testPrivateKey)
+	digest := transferDigest(testTransfer())
+	signature := signDigest(t, testPrivateKey, digest)
+
+	// Signature with a 27/28 recovery id //
+	legacySignature := append([]byte{}, signature...)
+	legacySignature[crypto.RecoveryIDOffset] += 27
+
+	// Malleable signature with the high s value //
+	n := crypto.S256().Params().N
+	s := new(big.Int).SetBytes(signature[32:64])
+	malleableSignature := append([]byte{}, signature[:32]...)
+	malleableSignature = append(malleableSignature,
+		common32(new(big.Int).Sub(n, s).Bytes())...)
+	malleableSignature = append(malleableSignature, signature[crypto.RecoveryIDOffset]^1)
+
+	tamperedTransfer := testTransfer()
+	tamperedTransfer.Amount = NewAmount(999999999)
+
+	tests := []struct {
+		name      string
+		address   string
+		digest    []byte
+		signature string
+		valid     bool
+	}{
+		{"valid", address, digest, hexutil.Encode(signature), true},
+		{"valid with legacy recovery id", address, digest, hexutil.Encode(legacySignature), true},
+		{"tampered transfer", address, transferDigest(tamperedTransfer),
+			hexutil.Encode(signature), false},
+		{"other signer", address, digest,
+			hexutil.Encode(signDigest(t, testOtherPrivateKey, digest)), false},
+		{"other address", keyAddress(t, testOtherPrivateKey), digest,
+			hexutil.Encode(signature), false},
+		{"malleable", address, digest, hexutil.Encode(malleableSignature), false},
+		{"empty", address, digest, "", false},
+		{"empty hex", address, digest, "0x", false},
+		{"short", address, digest, hexutil.Encode(signature[:64]), false},
+		{"long", address, digest, hexutil.Encode(append(signature, 0x00)), false},
+		{"not hex", address, digest, "signature", false},
+		{"invalid address", "0xFrom", digest, hexutil.Encode(signature), false},
+	}
+	for _, test := range tests {
+		err := validateSignature(test.address, test.digest, test.signature)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error %s", test.name, err.Error())
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: the signature should be rejected", test.name)
+		}
+	}
+}
+
+func common32(value []byte) []byte {
+	padded := make([]byte, 32)
+	copy(padded[32-len(value):], value)
+	return padded
+}
+
+func TestTransferFee(t *testing.T) {
+	schedule := FeeSchedule{FlatFee: NewAmount(0), BasisPoints: 250,
+		MinFee: NewAmount(0), MaxFee: NewAmount(0)}
+	coin := Token{TokenType: "CRYPTO", Decimals: 2}
+	pod := Token{TokenType: NFT_POD_TOKEN, Decimals: 2}
+
+	tests := []struct {
+		name   string
+		token  Token
+		amount Amount
+		fee    Amount
+	}{
+		{"basis points", coin, NewAmount(1000), NewAmount(25)},
+		{"pod rounded down", pod, WholeTokens(10, 2), NewAmount(0)},
+		{"pod whole fee", pod, WholeTokens(100, 2), WholeTokens(2, 2)},
+	}
+	for _, test := range tests {
+		fee := transferFee(schedule, test.token, test.amount)
+		if fee.Cmp(test.fee) != 0 {
+			t.Errorf("%s: expected %s, got %s", test.name, test.fee.String(), fee.String())
+		}
+		if test.token.TokenType == NFT_POD_TOKEN && !fee.IsWhole(test.token.Decimals) {
+			t.Errorf("%s: the fee of a pod token should be whole", test.name)
+		}
+	}
+}
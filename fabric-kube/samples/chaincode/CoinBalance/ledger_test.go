@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Ledger of the tests, running the calls of the contract on a MockStub at a given timestamp //
+type testLedger struct {
+	t        *testing.T
+	stub     *shim.MockStub
+	contract *CoinBalanceSmartContract
+	txCount  int
+}
+
+func newTestLedger(t *testing.T) *testLedger {
+	contract := new(CoinBalanceSmartContract)
+	return &testLedger{t: t, stub: shim.NewMockStub("CoinBalance", contract), contract: contract}
+}
+
+// Runs a function in a transaction of the given timestamp //
+func (l *testLedger) run(timestamp int64, call func(stub shim.ChaincodeStubInterface) error) error {
+	l.txCount++
+	txId := fmt.Sprintf("tx%d", l.txCount)
+	l.stub.MockTransactionStart(txId)
+	l.stub.TxTimestamp.Seconds = timestamp
+	err := call(l.stub)
+	l.stub.MockTransactionEnd(txId)
+
+	// Drain the events so that the buffered channel of the stub never blocks //
+	for {
+		select {
+		case <-l.stub.ChaincodeEventsChannel:
+		default:
+			return err
+		}
+	}
+}
+
+// Runs a handler of the contract in a transaction of the given timestamp //
+func (l *testLedger) call(timestamp int64,
+	handler func(stub shim.ChaincodeStubInterface, args []string) pb.Response,
+	args ...string) pb.Response {
+
+	var response pb.Response
+	l.run(timestamp, func(stub shim.ChaincodeStubInterface) error {
+		response = handler(stub, args)
+		return nil
+	})
+	return response
+}
+
+// Runs a handler that should succeed //
+func (l *testLedger) mustCall(timestamp int64,
+	handler func(stub shim.ChaincodeStubInterface, args []string) pb.Response,
+	args ...string) pb.Response {
+
+	response := l.call(timestamp, handler, args...)
+	if response.Status != shim.OK {
+		l.t.Fatalf("unexpected error: %s", response.Message)
+	}
+	return response
+}
+
+func (l *testLedger) must(err error) {
+	if err != nil {
+		l.t.Fatal(err)
+	}
+}
+
+func (l *testLedger) registerToken(symbol string, tokenType string, supply Amount) {
+	token := Token{
+		Name: symbol, Symbol: symbol, TokenType: tokenType, Supply: supply,
+		MaxSupply: NewAmount(0), Status: TOKEN_ACTIVE, DocType: DOC_TYPE_TOKEN}
+	l.must(l.run(0, func(stub shim.ChaincodeStubInterface) error {
+		return l.contract.updateToken(stub, token)
+	}))
+}
+
+func (l *testLedger) registerWallet(address string) {
+	wallet := Wallet{Address: address, PublicId: "user" + address}
+	l.must(l.run(0, func(stub shim.ChaincodeStubInterface) error {
+		return wallet.SaveState(stub)
+	}))
+}
+
+func (l *testLedger) setBalance(address string, token string, amount Amount, credit Amount) {
+	balance := Balance{
+		Address: address, Token: token, Amount: amount, Credit: credit,
+		DocType: DOC_TYPE_BALANCE}
+	l.must(l.run(0, func(stub shim.ChaincodeStubInterface) error {
+		return l.contract.updateBalance(stub, balance)
+	}))
+}
+
+func (l *testLedger) balance(address string, token string) Amount {
+	var balance Balance
+	l.must(l.run(0, func(stub shim.ChaincodeStubInterface) error {
+		var err error
+		balance, err = l.contract.checkBalance(stub, address, token, false)
+		return err
+	}))
+	return balance.Amount
+}
+
+func (l *testLedger) token(symbol string) Token {
+	var token Token
+	l.must(l.run(0, func(stub shim.ChaincodeStubInterface) error {
+		var err error
+		token, err = l.contract.getToken(stub, symbol)
+		return err
+	}))
+	return token
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestMigrateDocTypesInBatches(t *testing.T) {
+	l := newTestLedger(t)
+
+	// Balances and scores stored before the document types //
+	count := MAX_PAGE_SIZE + 5
+	l.must(l.run(0, func(stub shim.ChaincodeStubInterface) error {
+		for i := 0; i < count; i++ {
+			key, _ := stub.CreateCompositeKey(IndexBalances,
+				[]string{fmt.Sprintf("0x%03d", i), "PRIVI"})
+			value := fmt.Sprintf(`{"Address":"0x%03d","Token":"PRIVI","Amount":"10",`+
+				`"Credit":"0","LockUpDate":0}`, i)
+			if err := stub.PutState(key, []byte(value)); err != nil {
+				return err
+			}
+		}
+		return stub.PutState(IndexFinancialScores+"user1", []byte(`{"TrustScore":0.5}`))
+	}))
+
+	// Balances are migrated by batches resumed at the bookmark //
+	page := MigrationPage{}
+	args := []string{DOC_TYPE_BALANCE}
+	for _, migrated := range []int{MAX_PAGE_SIZE, 5} {
+		response := l.mustCall(0, l.contract.migrateDocTypes, args...)
+		page = MigrationPage{}
+		json.Unmarshal(response.Payload, &page)
+		if page.Migrated != migrated {
+			t.Fatalf("expected %d migrated states, got %d", migrated, page.Migrated)
+		}
+		args = []string{DOC_TYPE_BALANCE, page.Bookmark}
+	}
+	if page.Bookmark != "" {
+		t.Fatal("the bookmark should be empty once all the states are migrated")
+	}
+	holders := []string{}
+	l.must(l.run(0, func(stub shim.ChaincodeStubInterface) error {
+		var err error
+		holders, err = getTokenHolderList(stub, "PRIVI")
+		return err
+	}))
+	if len(holders) != count {
+		t.Errorf("every migrated balance should be indexed, got %d holders", len(holders))
+	}
+
+	// Scores stored under raw keys are migrated too //
+	response := l.mustCall(0, l.contract.migrateDocTypes, DOC_TYPE_FINANCIAL_SCORES)
+	json.Unmarshal(response.Payload, &page)
+	if page.Migrated != 1 {
+		t.Errorf("expected the financial scores to be migrated, got %d", page.Migrated)
+	}
+	scores := FinancialScores{}
+	json.Unmarshal(l.stub.State[IndexFinancialScores+"user1"], &scores)
+	if scores.DocType != DOC_TYPE_FINANCIAL_SCORES {
+		t.Error("the financial scores should have their document type")
+	}
+}
@@ -14,72 +14,440 @@ type CoinBalanceSmartContract struct{}
 
 // Definition the output for the smart contract //
 type Output struct {
-	UpdateBalances map[string]Balance  `json:"UpdateBalances"`
-	UpdateTokens   map[string]Token    `json:"UpdateTokens"`
-	Transactions   map[string]Transfer `json:"Transactions"`
+	UpdateBalances      map[string]Balance      `json:"UpdateBalances"`
+	UpdateTokens        map[string]Token        `json:"UpdateTokens"`
+	Transactions        map[string]Transfer     `json:"Transactions"`
+	UpdateAllowances    map[string]Allowance    `json:"UpdateAllowances,omitempty"`
+	UpdateCreditLines   map[string]CreditLine   `json:"UpdateCreditLines,omitempty"`
+	UpdateCreditPools   map[string]CreditPool   `json:"UpdateCreditPools,omitempty"`
+	UpdatePoolCredits   map[string]PoolCredit   `json:"UpdatePoolCredits,omitempty"`
+	Premiums            map[string]Premium      `json:"Premiums,omitempty"`
+	UpdateAirdrops      map[string]Airdrop      `json:"UpdateAirdrops,omitempty"`
+	Audits              map[string]TokenAudit   `json:"Audits,omitempty"`
+	UpdateProposals     map[string]Proposal     `json:"UpdateProposals,omitempty"`
+	UpdateMinterQuotas  map[string]MinterQuota  `json:"UpdateMinterQuotas,omitempty"`
+	UpdateItems         map[string]NFTItem      `json:"UpdateItems,omitempty"`
+	UpdateItemOperators map[string]ItemOperator `json:"UpdateItemOperators,omitempty"`
+	UpdateDividends     map[string]Dividend     `json:"UpdateDividends,omitempty"`
+}
+
+// Definition of the event emitted by a transaction with the updates of its output //
+type Event struct {
+	Version   int    `json:"Version"`
+	Name      string `json:"Name"`
+	TxId      string `json:"TxId"`
+	Timestamp int64  `json:"Timestamp"`
+	Output    Output `json:"Output"`
 }
 
 // Definition of the user Balance for a given token //
 type Balance struct {
-	Address    string  `json:"Address"`
-	Token      string  `json:"Token"`
-	Amount     float64 `json:"Amount"`
-	Credit     float64 `json:"Credit"`
-	LockUpDate int64   `json:"LockUpDate"`
+	Address    string `json:"Address"`
+	Token      string `json:"Token"`
+	Amount     Amount `json:"Amount"`
+	Credit     Amount `json:"Credit"`
+	LockUpDate int64  `json:"LockUpDate"`
+	Items      int64  `json:"Items,omitempty"`
+	AmountKey  string `json:"AmountKey,omitempty"`
+	DocType    string `json:"docType"`
+}
+
+// Definition of the access rule of a function. The caller should have one of the Roles and //
+// belong to one of the MSPs when they are set, and satisfy every predicate of Attributes   //
+type AccessRule struct {
+	Function   string            `json:"Function"`
+	Roles      []string          `json:"Roles"`
+	MSPs       []string          `json:"MSPs"`
+	Attributes map[string]string `json:"Attributes"`
+}
+
+// Definition of the approvers of the governance proposals. Approvers are identities given as //
+// MSPID::ID and a proposal needs Threshold approvals to be executed before its expiry         //
+type Governance struct {
+	Approvers        []string `json:"Approvers"`
+	Threshold        int      `json:"Threshold"`
+	ProposalLifetime int64    `json:"ProposalLifetime"`
+}
+
+// Definition of a governance proposal to run an action with the Payload as arguments. //
+// Approvals holds the timestamp of the approval of every approver                     //
+type Proposal struct {
+	Id           string           `json:"Id"`
+	Action       string           `json:"Action"`
+	Payload      []string         `json:"Payload"`
+	Proposer     string           `json:"Proposer"`
+	Approvals    map[string]int64 `json:"Approvals"`
+	Status       string           `json:"Status"`
+	Created      int64            `json:"Created"`
+	Expiry       int64            `json:"Expiry"`
+	ExecutedTxId string           `json:"ExecutedTxId,omitempty"`
+}
+
+// Definition of the fee charged to the sender of the transfers of a token. The fee is the //
+// FlatFee plus the BasisPoints of the amount bounded by MinFee and MaxFee (0 for no max), //
+// and it is paid to the Treasury. Operators with one of the ExemptRoles pay no fee on the //
+// transfers they settle without the envelope of the sender                                //
+type FeeSchedule struct {
+	Token       string   `json:"Token"`
+	Treasury    string   `json:"Treasury"`
+	FlatFee     Amount   `json:"FlatFee"`
+	BasisPoints int64    `json:"BasisPoints"`
+	MinFee      Amount   `json:"MinFee"`
+	MaxFee      Amount   `json:"MaxFee"`
+	ExemptRoles []string `json:"ExemptRoles"`
+}
+
+// Definition of the quota of a minter identity (MSPID::ID) to mint a token. The Minted amount //
+// is reset every Period seconds from PeriodStart, a Period of 0 never resets it               //
+type MinterQuota struct {
+	Minter      string `json:"Minter"`
+	Token       string `json:"Token"`
+	Quota       Amount `json:"Quota"`
+	Period      int64  `json:"Period"`
+	PeriodStart int64  `json:"PeriodStart"`
+	Minted      Amount `json:"Minted"`
+	Remaining   Amount `json:"Remaining"`
+}
+
+// Definition of an item of a NFT POD token. Every item backs one whole token of the balance //
+// of its Owner, which cannot be spent by fungible transfers. Approved can transfer the item  //
+type NFTItem struct {
+	Token        string `json:"Token"`
+	ItemId       string `json:"ItemId"`
+	Owner        string `json:"Owner"`
+	Approved     string `json:"Approved,omitempty"`
+	MetadataURI  string `json:"MetadataURI"`
+	MetadataHash string `json:"MetadataHash"`
+	Minted       int64  `json:"Minted"`
+}
+
+// Definition of an operator allowed to transfer and approve all the items of a token of an owner //
+type ItemOperator struct {
+	Owner    string `json:"Owner"`
+	Token    string `json:"Token"`
+	Operator string `json:"Operator"`
+	Approved bool   `json:"Approved"`
+}
+
+// Definition of an operation on the items of a NFT POD token signed by the Signer //
+type ItemOperation struct {
+	Token    string `json:"Token"`
+	ItemId   string `json:"ItemId"`
+	From     string `json:"From"`
+	To       string `json:"To"`
+	Approved bool   `json:"Approved"`
+	Signer   string `json:"Signer"`
+	Id       string `json:"Id"`
+	Date     int64  `json:"Date"`
+	Nonce    uint64 `json:"Nonce"`
+}
+
+// Definition of a pro-rata distribution of a payout token to the holders of a FT POD token. The //
+// TotalAmount is escrowed from the Source and the holders are walked in batches in address order //
+// after the Cursor: a first pass sums their balances in PodSupply until it is Counted, then a    //
+// second pass pays each one its share of the PodSupply. The pod token is paused while the        //
+// distribution is OPEN and the rounding remainder is returned to the Source when it completes    //
+type Dividend struct {
+	Id          string `json:"Id"`
+	PodToken    string `json:"PodToken"`
+	PayoutToken string `json:"PayoutToken"`
+	Source      string `json:"Source"`
+	TotalAmount Amount `json:"TotalAmount"`
+	PodSupply   Amount `json:"PodSupply"`
+	Counted     bool   `json:"Counted"`
+	Remaining   Amount `json:"Remaining"`
+	Paid        int    `json:"Paid"`
+	Cursor      string `json:"Cursor"`
+	Status      string `json:"Status"`
+	Created     int64  `json:"Created"`
+	Completed   int64  `json:"Completed,omitempty"`
+}
+
+// Definition of the payout of a dividend to a holder, recorded under the dividend so that every //
+// holder is paid at most once by a dividend                                                    //
+type DividendPayout struct {
+	DividendId string `json:"DividendId"`
+	Address    string `json:"Address"`
+	Amount     Amount `json:"Amount"`
+	TxId       string `json:"TxId"`
+	Date       int64  `json:"Date"`
+}
+
+// Definition of the configuration of the smart contract //
+type Config struct {
+	MaxDateSkew int64 `json:"MaxDateSkew"`
 }
 
 // Definition of the user Balance for a given token //
 type FinancialScores struct {
 	TrustScore       float64 `json:"TrustScore"`
 	EndorsementScore float64 `json:"EndorsementScore"`
+	DocType          string  `json:"docType"`
 }
 
 // Definition of a Token Transfer //
 type Transfer struct {
-	Type           string  `json:"Type"`
-	Token          string  `json:"Token"`
-	From           string  `json:"From"`
-	To             string  `json:"To"`
-	AvoidCheckTo   bool    `json:"AvoidCheckTo"`
-	AvoidCheckFrom bool    `json:"AvoidCheckFrom"`
-	Amount         float64 `json:"Amount"`
+	Type           string `json:"Type"`
+	Token          string `json:"Token"`
+	From           string `json:"From"`
+	To             string `json:"To"`
+	AvoidCheckTo   bool   `json:"AvoidCheckTo"`
+	AvoidCheckFrom bool   `json:"AvoidCheckFrom"`
+	Amount         Amount `json:"Amount"`
+	Id             string `json:"Id"`
+	Date           int64  `json:"Date"`
+	ClientDate     int64  `json:"ClientDate,omitempty"`
+	Nonce          uint64 `json:"Nonce"`
+	Spender        string `json:"Spender,omitempty"`
+}
+
+// Definition of a processed Transfer stored for replay protection //
+type TransactionRecord struct {
+	Transfer  Transfer `json:"Transfer"`
+	TxId      string   `json:"TxId"`
+	Timestamp int64    `json:"Timestamp"`
+}
+
+// Definition of the amount a spender can transfer on behalf of an owner //
+type Allowance struct {
+	Owner   string `json:"Owner"`
+	Spender string `json:"Spender"`
+	Token   string `json:"Token"`
+	Amount  Amount `json:"Amount"`
+}
+
+// Definition of a credit line granted to an address for a token. The outstanding //
+// credit drawn is kept in Balance.Credit                                           //
+type CreditLine struct {
+	Address  string `json:"Address"`
+	Token    string `json:"Token"`
+	PublicId string `json:"PublicId"`
+	Limit    Amount `json:"Limit"`
+	Grantor  string `json:"Grantor"`
+}
+
+// Definition of the state of a credit line at query time //
+type CreditStatus struct {
+	CreditLine  CreditLine `json:"CreditLine"`
+	TrustScore  float64    `json:"TrustScore"`
+	Outstanding Amount     `json:"Outstanding"`
+	Available   Amount     `json:"Available"`
+}
+
+// Definition of a credit pool lending the funds held by its Address. The premiums charged //
+// to the borrowers of the pool are paid to its PremiumAddress. TotalLent is the credit    //
+// still owed to the pool                                                                  //
+type CreditPool struct {
 	Id             string  `json:"Id"`
-	Date           int64   `json:"Date"`
+	Token          string  `json:"Token"`
+	Address        string  `json:"Address"`
+	PremiumAddress string  `json:"PremiumAddress"`
+	PremiumRate    float64 `json:"PremiumRate"`
+	TotalLent      Amount  `json:"TotalLent"`
+	TotalPremium   Amount  `json:"TotalPremium"`
+}
+
+// Definition of the credit granted to an address by a credit pool. Drawn includes premiums //
+// and is reduced by the repayments of the address                                          //
+type PoolCredit struct {
+	Address string `json:"Address"`
+	Token   string `json:"Token"`
+	PoolId  string `json:"PoolId"`
+	Limit   Amount `json:"Limit"`
+	Drawn   Amount `json:"Drawn"`
+}
+
+// Definition of the premium charged by a credit pool on the credit drawn by a spending //
+type Premium struct {
+	PoolId      string  `json:"PoolId"`
+	TxnId       string  `json:"TxnId"`
+	Spender     string  `json:"Spender"`
+	Provider    string  `json:"Provider"`
+	Token       string  `json:"Token"`
+	Credit      Amount  `json:"Credit"`
+	PremiumRate float64 `json:"PremiumRate"`
+	Amount      Amount  `json:"Amount"`
+	Date        int64   `json:"Date"`
+}
+
+// Definition of an airdrop of a token to the leaves of a Keccak Merkle tree. The Remaining //
+// amount is escrowed from the balance of the Funder and can be reclaimed after Expiry      //
+type Airdrop struct {
+	Id        string `json:"Id"`
+	Token     string `json:"Token"`
+	Root      string `json:"Root"`
+	Funder    string `json:"Funder"`
+	Total     Amount `json:"Total"`
+	Remaining Amount `json:"Remaining"`
+	Expiry    int64  `json:"Expiry"`
+}
+
+// Definition of a claim of an airdrop with the Merkle proof of its leaf //
+type AirdropClaim struct {
+	AirdropId string   `json:"AirdropId"`
+	Index     uint64   `json:"Index"`
+	Address   string   `json:"Address"`
+	Amount    Amount   `json:"Amount"`
+	Proof     []string `json:"Proof"`
+}
+
+// Definition of a word of the bitmap of the claimed leaves of an airdrop //
+type ClaimBitmap struct {
+	AirdropId string `json:"AirdropId"`
+	Word      uint64 `json:"Word"`
+	Bits      string `json:"Bits"`
+}
+
+// Definition of the reconciliation of the supply of a token with its balances. The sum of the //
+// Balances minus the Credit outstanding plus the Escrowed amounts should be equal to Supply.   //
+// Audits stored on the ledger keep the identity of the auditor and the digest of the record    //
+type TokenAudit struct {
+	Token          string `json:"Token"`
+	Supply         Amount `json:"Supply"`
+	Balances       Amount `json:"Balances"`
+	Credit         Amount `json:"Credit"`
+	Escrowed       Amount `json:"Escrowed"`
+	Discrepancy    Amount `json:"Discrepancy"`
+	Holders        int    `json:"Holders"`
+	IndexedHolders int    `json:"IndexedHolders"`
+	Timestamp      int64  `json:"Timestamp"`
+	TxId           string `json:"TxId"`
+	Auditor        string `json:"Auditor,omitempty"`
+	AuditorMSP     string `json:"AuditorMSP,omitempty"`
+	Digest         string `json:"Digest,omitempty"`
+}
+
+// Definition of the vesting schedule of the tokens granted to a holder. Nothing is released //
+// before the Cliff, then the Total is released linearly until End or in equal Steps.       //
+// Balance.LockUpDate holds the End of the active schedule of the balance                   //
+type VestingSchedule struct {
+	Address   string `json:"Address"`
+	Token     string `json:"Token"`
+	Total     Amount `json:"Total"`
+	Start     int64  `json:"Start"`
+	Cliff     int64  `json:"Cliff"`
+	End       int64  `json:"End"`
+	Steps     int    `json:"Steps"`
+	Revocable bool   `json:"Revocable"`
+	Revoked   bool   `json:"Revoked"`
+}
+
+// Definition of the state of a vesting schedule at query time //
+type VestingStatus struct {
+	VestingSchedule VestingSchedule `json:"VestingSchedule"`
+	Timestamp       int64           `json:"Timestamp"`
+	Locked          Amount          `json:"Locked"`
+	Unlocked        Amount          `json:"Unlocked"`
+}
+
+// Definition of the envelope signed by a sender of a multitransfer //
+type SignedEnvelope struct {
+	From      string `json:"From"`
+	Nonce     uint64 `json:"Nonce"`
+	Signature string `json:"Signature"`
+}
+
+// Definition of a wallet address attached to an actor. Wallets registered before actors could //
+// hold several addresses are stored under the raw key IndexWallets+Address without owner       //
+type Wallet struct {
+	Address  string `json:"Address"`
+	PublicId string `json:"PublicId"`
+}
+
+// Definition of an operation on a wallet address signed by the key of the address. Approved //
+// is the address attached or set as primary with the approval of the primary Address     //
+type WalletOperation struct {
+	PublicId  string `json:"PublicId"`
+	Address   string `json:"Address"`
+	Approved  string `json:"Approved,omitempty"`
+	Nonce     uint64 `json:"Nonce"`
+	Signature string `json:"Signature"`
+}
+
+// Definition of the next transfer nonce expected from an address //
+type AddressNonce struct {
+	Address string `json:"Address"`
+	Nonce   uint64 `json:"Nonce"`
 }
 
 // Definition of Token Objects in Blockchain //
 type Token struct {
-	Name       string  `json:"Name"`
-	TokenType  string  `json:"TokenType"`
-	Symbol     string  `json:"Symbol"`
-	Supply     float64 `json:"Supply"`
-	LockUpDate int64   `json:"LockUpDate"`
+	Name       string `json:"Name"`
+	TokenType  string `json:"TokenType"`
+	Symbol     string `json:"Symbol"`
+	Decimals   int    `json:"Decimals"`
+	Supply     Amount `json:"Supply"`
+	MaxSupply  Amount `json:"MaxSupply"`
+	LockUpDate int64  `json:"LockUpDate"`
+	Status     string `json:"Status"`
+	DocType    string `json:"docType"`
 }
 
-// Definition of a Token Swapping //
+// Definition of a minting of a token to several addresses //
 type MultiMinter struct {
-	Token       string             `json:"Token"`
-	Type        string             `json:"Type"`
-	TxnId       string             `json:"TxnId"`
-	FromAddress string             `json:"FromAddress"`
-	Date        string             `json:"Date"`
-	TotalAmount float64            `json:"TotalAmount"`
-	Transfers   map[string]float64 `json:"Transfers"`
+	Token       string            `json:"Token"`
+	Type        string            `json:"Type"`
+	TxnId       string            `json:"TxnId"`
+	FromAddress string            `json:"FromAddress"`
+	Date        int64             `json:"Date"`
+	TotalAmount Amount            `json:"TotalAmount"`
+	Transfers   map[string]Amount `json:"Transfers"`
 }
 
-// Definition of a user history retrieval //
+// Definition of a balance history retrieval //
 type History struct {
-	PublicId  string `json:"PublicId"`
-	Timestamp int64  `json:"Timestamp"`
+	Address       string `json:"Address"`
+	Token         string `json:"Token"`
+	FromTimestamp int64  `json:"FromTimestamp"`
+	ToTimestamp   int64  `json:"ToTimestamp"`
+	PageSize      int    `json:"PageSize"`
+	Bookmark      string `json:"Bookmark"`
+}
+
+// Definition of the pagination and sorting of a rich query //
+type PageQuery struct {
+	PageSize  int32  `json:"PageSize"`
+	Bookmark  string `json:"Bookmark"`
+	SortBy    string `json:"SortBy"`
+	SortOrder string `json:"SortOrder"`
+}
+
+// Definition of a batch of a state migration. Bookmark is the last migrated key //
+type MigrationPage struct {
+	DocType  string `json:"docType"`
+	Migrated int    `json:"Migrated"`
+	Bookmark string `json:"Bookmark"`
+}
+
+// Definition of a page of results of a rich query. Bookmark is used to get the next page //
+type QueryPage struct {
+	Records             interface{} `json:"Records"`
+	FetchedRecordsCount int32       `json:"FetchedRecordsCount"`
+	Bookmark            string      `json:"Bookmark"`
+}
+
+// Definition of a change of a balance in its history //
+type BalanceChange struct {
+	TxId           string `json:"TxId"`
+	Timestamp      int64  `json:"Timestamp"`
+	PreviousAmount Amount `json:"PreviousAmount"`
+	NewAmount      Amount `json:"NewAmount"`
+	IsDelete       bool   `json:"IsDelete"`
+}
+
+// Definition of a page of the history of a balance. Bookmark is empty on the last page //
+type HistoryPage struct {
+	Changes  []BalanceChange `json:"Changes"`
+	Bookmark string          `json:"Bookmark"`
 }
 
 // Definition of a Token Swapping //
 type Swapper struct {
-	PublicId string  `json:"PublicId"`
-	Token    string  `json:"Token"`
-	Amount   float64 `json:"Amount"`
-	TxnId    string  `json:"TxnId"`
-	Date     int64   `json:"Date"`
+	PublicId string `json:"PublicId"`
+	Token    string `json:"Token"`
+	Amount   Amount `json:"Amount"`
+	TxnId    string `json:"TxnId"`
+	Date     int64  `json:"Date"`
 }
 
 /*---------------------------------------------------------------------------
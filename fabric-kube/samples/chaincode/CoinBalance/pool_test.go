@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Signs a transfer of the given type with the test key //
+func signedTransferArgs(t *testing.T, operationType string, transfer Transfer) []string {
+	transferBytes, err := json.Marshal(transfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := signDigest(t, testPrivateKey, typedTransferDigest(operationType, transfer))
+	return []string{string(transferBytes), hexutil.Encode(signature)}
+}
+
+func (l *testLedger) poolCredit(address string, token string, poolId string) PoolCredit {
+	credit := PoolCredit{Address: address, Token: token, PoolId: poolId}
+	l.must(l.run(0, func(stub shim.ChaincodeStubInterface) error {
+		_, err := credit.LoadState(stub)
+		return err
+	}))
+	return credit
+}
+
+func TestRepayPoolCredit(t *testing.T) {
+	l := newTestLedger(t)
+	borrower := keyAddress(t, testPrivateKey)
+	l.registerToken("PRIVI", "CRYPTO", NewAmount(1000))
+	for _, address := range []string{borrower, "0xP", "0xR", "0xV"} {
+		l.registerWallet(address)
+	}
+	l.setBalance("0xP", "PRIVI", NewAmount(1000), NewAmount(0))
+	l.mustCall(0, l.contract.setCreditPool, `{"Id":"pool1","Token":"PRIVI",`+
+		`"Address":"0xP","PremiumAddress":"0xR","PremiumRate":0.25}`)
+	l.mustCall(0, l.contract.grantPoolCredit,
+		`{"Address":"`+borrower+`","PoolId":"pool1","Limit":"125"}`)
+
+	// The whole limit is drawn with its premium //
+	spending := Transfer{
+		Token: "PRIVI", From: borrower, To: "0xV", Amount: NewAmount(100), Id: "spend1"}
+	l.mustCall(0, l.contract.spendFunds, signedTransferArgs(t, SPEND_FUNDS_TYPE, spending)...)
+	if drawn := l.poolCredit(borrower, "PRIVI", "pool1").Drawn; drawn.Cmp(NewAmount(125)) != 0 {
+		t.Fatalf("expected 125 drawn, got %s", drawn.String())
+	}
+	spending = Transfer{
+		Token: "PRIVI", From: borrower, To: "0xV", Amount: NewAmount(1), Id: "spend2", Nonce: 1}
+	response := l.call(0, l.contract.spendFunds,
+		signedTransferArgs(t, SPEND_FUNDS_TYPE, spending)...)
+	if response.Status == shim.OK {
+		t.Fatal("spending over the credit limit should fail")
+	}
+
+	// Repaying more than drawn is rejected and the debt is repaid to the pool. The MockStub //
+	// keeps the nonces consumed by the rejected calls                                         //
+	l.setBalance(borrower, "PRIVI", NewAmount(200), NewAmount(0))
+	repayment := Transfer{
+		Token: "PRIVI", From: borrower, To: "pool1", Amount: NewAmount(126), Id: "repay1",
+		Nonce: 2}
+	response = l.call(0, l.contract.repayPoolCredit,
+		signedTransferArgs(t, REPAY_POOL_CREDIT_TYPE, repayment)...)
+	if response.Status == shim.OK {
+		t.Fatal("repaying more than the credit drawn should fail")
+	}
+	repayment.Amount = NewAmount(125)
+	repayment.Nonce = 3
+	l.mustCall(0, l.contract.repayPoolCredit,
+		signedTransferArgs(t, REPAY_POOL_CREDIT_TYPE, repayment)...)
+	if drawn := l.poolCredit(borrower, "PRIVI", "pool1").Drawn; drawn.Sign() != 0 {
+		t.Fatalf("expected the credit to be repaid, got %s drawn", drawn.String())
+	}
+	if balance := l.balance("0xP", "PRIVI"); balance.Cmp(NewAmount(1000)) != 0 {
+		t.Fatalf("expected the pool to hold 1000, got %s", balance.String())
+	}
+	if balance := l.balance(borrower, "PRIVI"); balance.Cmp(NewAmount(75)) != 0 {
+		t.Fatalf("expected the borrower to hold 75, got %s", balance.String())
+	}
+	l.must(l.run(0, func(stub shim.ChaincodeStubInterface) error {
+		pool, err := getCreditPool(stub, "pool1")
+		if err == nil && pool.TotalLent.Sign() != 0 {
+			t.Errorf("expected nothing lent by the pool, got %s", pool.TotalLent.String())
+		}
+		return err
+	}))
+
+	// The repaid credit can be drawn again //
+	spending = Transfer{
+		Token: "PRIVI", From: borrower, To: "0xV", Amount: NewAmount(175), Id: "spend3", Nonce: 4}
+	l.mustCall(0, l.contract.spendFunds, signedTransferArgs(t, SPEND_FUNDS_TYPE, spending)...)
+	if drawn := l.poolCredit(borrower, "PRIVI", "pool1").Drawn; drawn.Cmp(NewAmount(125)) != 0 {
+		t.Fatalf("expected 125 drawn again, got %s", drawn.String())
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func TestUpdateTokenInfoKeepsMaxSupply(t *testing.T) {
+	l := newTestLedger(t)
+	token := Token{
+		Name: "Privi Coin", Symbol: "PRIVI", TokenType: "CRYPTO", Supply: NewAmount(100),
+		MaxSupply: NewAmount(1000), Status: TOKEN_ACTIVE}
+	l.must(l.run(0, func(stub shim.ChaincodeStubInterface) error {
+		return l.contract.updateToken(stub, token)
+	}))
+
+	tests := []struct {
+		name      string
+		input     string
+		maxSupply Amount
+	}{
+		{"without max supply", `{"Symbol":"PRIVI","Name":"Privi"}`, NewAmount(1000)},
+		{"new max supply", `{"Symbol":"PRIVI","Name":"Privi","MaxSupply":"500"}`, NewAmount(500)},
+		{"no cap", `{"Symbol":"PRIVI","Name":"Privi","MaxSupply":"0"}`, NewAmount(0)},
+	}
+	for _, test := range tests {
+		l.mustCall(0, l.contract.updateTokenInfo, test.input)
+		if l.token("PRIVI").MaxSupply.Cmp(test.maxSupply) != 0 {
+			t.Errorf("%s: expected %s, got %s", test.name, test.maxSupply.String(),
+				l.token("PRIVI").MaxSupply.String())
+		}
+	}
+}
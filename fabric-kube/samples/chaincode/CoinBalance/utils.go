@@ -6,6 +6,7 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -84,20 +85,46 @@ func stringInSlice(a string, list []string) bool {
 	return false
 }
 
-func saveSubstraction(main float64, amount float64) (float64, error) {
-	main -= amount
-	if main < 0. {
+func saveSubstraction(main Amount, amount Amount) (Amount, error) {
+	if amount.Sign() < 0 {
+		return main, errors.New("ERROR: NEGATIVE AMOUNTS ARE NOT ALLOWED")
+	}
+	if main.Cmp(amount) < 0 {
 		return main, errors.New("ERROR: INSUFFICIENT FUNDS ON BALANCE")
 	}
-	return main, nil
+	return main.Sub(amount), nil
 }
 
-func saveAddition(main float64, amount float64) (float64, error) {
-	if main+amount < main {
-		return main, errors.New("ERROR: OVERFLOW ON RECEIVER BALANCE")
+func saveAddition(main Amount, amount Amount) (Amount, error) {
+	if amount.Sign() < 0 {
+		return main, errors.New("ERROR: NEGATIVE AMOUNTS ARE NOT ALLOWED")
 	}
-	main += amount
-	return main, nil
+	return main.Add(amount), nil
+}
+
+// Substracts an amount using the available credit once the main balance is exhausted //
+func saveCreditSubstraction(main Amount, credit Amount, available Amount,
+	amount Amount) (Amount, Amount, error) {
+	if amount.Sign() < 0 {
+		return main, credit, errors.New("ERROR: NEGATIVE AMOUNTS ARE NOT ALLOWED")
+	}
+	if main.Cmp(amount) >= 0 {
+		return main.Sub(amount), credit, nil
+	}
+	shortfall := amount.Sub(main)
+	if available.Cmp(shortfall) < 0 {
+		return main, credit, errors.New("ERROR: INSUFFICIENT FUNDS ON BALANCE")
+	}
+	return NewAmount(0), credit.Add(shortfall), nil
+}
+
+// Adds an amount repaying first the outstanding credit //
+func saveCreditAddition(main Amount, credit Amount, amount Amount) (Amount, Amount, error) {
+	if amount.Sign() < 0 {
+		return main, credit, errors.New("ERROR: NEGATIVE AMOUNTS ARE NOT ALLOWED")
+	}
+	repayment := MinAmount(credit, amount)
+	return main.Add(amount.Sub(repayment)), credit.Sub(repayment), nil
 }
 
 func checkRange(number float64, lowerBound float64, upperBound float64) bool {
@@ -135,3 +162,16 @@ func mergeMaps(map1 map[string]Balance,
 
 /* -------------------------------------------------------------------------------------------------
 -------------------------------------------------------------------------------------------------*/
+
+/* -------------------------------------------------------------------------------------------------
+ checkArgs: this function checks that a function is called with the arguments it reads, so that a
+            missing argument is rejected instead of panicking
+------------------------------------------------------------------------------------------------- */
+
+func checkArgs(args []string, count int, function string) error {
+	if len(args) < count {
+		return fmt.Errorf("ERROR: %s FUNCTION SHOULD BE CALLED WITH AT LEAST %d ARGUMENTS.",
+			strings.ToUpper(function), count)
+	}
+	return nil
+}
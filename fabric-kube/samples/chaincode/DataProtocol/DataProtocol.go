@@ -12,14 +12,20 @@ import (
 
 /* -------------------------------------------------------------------------------------------------
 Init:  this function register Cache as the Admin of the Network at the deployment of the
-       Cache Blockchain. Args: array containing a string:
+       Cache Blockchain. It seeds the access rules of the functions that have no rule yet, also
+       on upgrades. Args: array containing a string:
 PrivateKeyID           string   // Private Key of the admin of the smart contract
 ------------------------------------------------------------------------------------------------- */
 
 func (t *DataProtocolSmartContract) Init(stub shim.ChaincodeStubInterface) pb.Response {
 
+	err := seedAccessRules(stub)
+	if err != nil {
+		return shim.Error("ERROR: SEEDING THE ACCESS RULES. " + err.Error())
+	}
+
 	_, args := stub.GetFunctionAndParameters()
-	if args[0] == "UPGRADE" {
+	if len(args) > 0 && args[0] == "UPGRADE" {
 		return shim.Success(nil)
 	}
 
@@ -36,10 +42,10 @@ func (t *DataProtocolSmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.
 	// Retrieve function and arguments //
 	function, args := stub.GetFunctionAndParameters()
 
-	//if err := cid.AssertAttributeValue(stub, "userRole", ADMIN_ROLE); err != nil {
-	//	message := "PERMISSION DENIED TO CALL DATA PROTOCOL"
-	//	return pb.Response{Status: 403, Message: message}
-	//}
+	// Check the caller against the access rule of the function //
+	if err := checkAccess(stub, function); err != nil {
+		return shim.Error(err.Error())
+	}
 
 	// Call the proper function //
 	switch function {
@@ -47,7 +53,24 @@ func (t *DataProtocolSmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.
 		return t.register(stub, args)
 	case "attachAddress":
 		return t.attachAddress(stub, args)
+	case "detachAddress":
+		return t.detachAddress(stub, args)
+	case "setPrimaryAddress":
+		return t.setPrimaryAddress(stub, args)
+	case "getUserByAddress":
+		if err := checkArgs(args, 1, "getUserByAddress"); err != nil {
+			return shim.Error(err.Error())
+		}
+		actor, err := getAddressOwner(stub, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		actorBytes, _ := json.Marshal(actor)
+		return shim.Success(actorBytes)
 	case "getUser":
+		if err := checkArgs(args, 1, "getUser"); err != nil {
+			return shim.Error(err.Error())
+		}
 		actor, err := getActor(stub, args[0])
 		if err != nil {
 			return shim.Error(err.Error())
@@ -55,6 +78,9 @@ func (t *DataProtocolSmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.
 		actorBytes, _ := json.Marshal(actor)
 		return shim.Success(actorBytes)
 	case "getRoleList":
+		if err := checkArgs(args, 1, "getRoleList"); err != nil {
+			return shim.Error(err.Error())
+		}
 		actorList, err := getRoleList(stub, args[0])
 		if err != nil {
 			return shim.Error(err.Error())
@@ -62,6 +88,55 @@ func (t *DataProtocolSmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.
 		actorListBytes, _ := json.Marshal(actorList)
 		return shim.Success(actorListBytes)
 
+	case "getRoleListPage":
+		if len(args) != 2 {
+			return shim.Error("ERROR: GETROLELISTPAGE FUNCTION SHOULD BE CALLED " +
+				"WITH TWO ARGUMENTS.")
+		}
+		pageQuery := PageQuery{}
+		err := json.Unmarshal([]byte(args[1]), &pageQuery)
+		if err != nil {
+			return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+		}
+		page, err := getRoleListPage(stub, args[0], pageQuery)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		pageBytes, _ := json.Marshal(page)
+		return shim.Success(pageBytes)
+
+	case "migrateDocTypes":
+		return t.migrateDocTypes(stub, args)
+
+	case "setAccessRule":
+		return t.setAccessRule(stub, args)
+
+	case "removeAccessRule":
+		return t.removeAccessRule(stub, args)
+
+	case "getAccessRule":
+		if err := checkArgs(args, 1, "getAccessRule"); err != nil {
+			return shim.Error(err.Error())
+		}
+		rule := AccessRule{Function: args[0]}
+		isLoaded, err := rule.LoadState(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !isLoaded {
+			return shim.Error("ERROR: THE FUNCTION " + args[0] + " HAS NO ACCESS RULE.")
+		}
+		ruleBytes, _ := json.Marshal(rule)
+		return shim.Success(ruleBytes)
+
+	case "getAccessRules":
+		rules, err := getAccessRules(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		rulesBytes, _ := json.Marshal(rules)
+		return shim.Success(rulesBytes)
+
 		// case "getRoleList":
 		// 	return t.getRoleList(stub, args)
 		// case "getPrivacy":
@@ -90,7 +165,130 @@ func (t *DataProtocolSmartContract) Invoke(stub shim.ChaincodeStubInterface) pb.
 }
 
 /* -------------------------------------------------------------------------------------------------
-register:  temporarily register funciton
+setAccessRule: This function is called by an admin to set the access rule of a function. The rules
+               of the functions managing the access rules should always allow the admins.
+               Args: array containing a json with:
+Function           string              // Name of the function
+Roles              []string            // Roles allowed to call the function (empty for any role)
+MSPs               []string            // MSPs allowed to call the function (empty for any MSP)
+Attributes         map[string]string   // Attribute values required to the caller ("*" for any)
+------------------------------------------------------------------------------------------------- */
+
+func (t *DataProtocolSmartContract) setAccessRule(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: SETACCESSRULE FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	rule := AccessRule{}
+	err := json.Unmarshal([]byte(args[0]), &rule)
+	if err != nil {
+		return shim.Error("ERROR: GETTING INPUT INFORMATION. " + err.Error())
+	}
+	if rule.Function == "" {
+		return shim.Error("ERROR: THE FUNCTION OF THE ACCESS RULE CANNOT BE EMPTY.")
+	}
+	if stringInSlice(rule.Function, aclFunctions) && !stringInSlice(ADMIN_ROLE, rule.Roles) {
+		return shim.Error("ERROR: THE ACCESS RULE OF " + rule.Function + " SHOULD " +
+			"ALLOW THE " + ADMIN_ROLE + " ROLE.")
+	}
+	if stringInSlice(rule.Function, adminOnlyFunctions) &&
+		(len(rule.Roles) != 1 || rule.Roles[0] != ADMIN_ROLE) {
+		return shim.Error("ERROR: THE ACCESS RULE OF " + rule.Function + " SHOULD ONLY " +
+			"ALLOW THE " + ADMIN_ROLE + " ROLE.")
+	}
+
+	err = rule.SaveState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ruleBytes, _ := json.Marshal(rule)
+	return shim.Success(ruleBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+removeAccessRule: This function is called by an admin to remove the access rule of a function, which
+                  cannot be called anymore until a rule is set again.
+Function           string    // Name of the function (args[0])
+------------------------------------------------------------------------------------------------- */
+
+func (t *DataProtocolSmartContract) removeAccessRule(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Retrieve information from the input //
+	if len(args) != 1 {
+		return shim.Error("ERROR: REMOVEACCESSRULE FUNCTION SHOULD BE CALLED " +
+			"WITH ONE ARGUMENT.")
+	}
+	if stringInSlice(args[0], aclFunctions) {
+		return shim.Error("ERROR: THE ACCESS RULE OF " + args[0] + " CANNOT BE REMOVED.")
+	}
+	rule := AccessRule{Function: args[0]}
+	compositeKey, err := rule.ToCompositeKey(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(compositeKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/* -------------------------------------------------------------------------------------------------
+migrateDocTypes: this function rewrites the actors stored before the docType field was introduced,
+                 by batches of MAX_PAGE_SIZE actors. It should be called again with the returned
+                 bookmark until the bookmark is empty.
+Bookmark            string    // Bookmark returned by the previous batch (optional args[0])
+------------------------------------------------------------------------------------------------- */
+
+func (t *DataProtocolSmartContract) migrateDocTypes(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	page := MigrationPage{DocType: DOC_TYPE_ACTOR}
+	if len(args) > 0 {
+		page.Bookmark = args[0]
+	}
+
+	// Rewrite actors with their document type, resuming after the bookmark //
+	it, err := stub.GetStateByPartialCompositeKey(IndexNetwork, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer it.Close()
+	bookmark := page.Bookmark
+	page.Bookmark = ""
+	for it.HasNext() {
+		response, err := it.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if bookmark != "" && response.Key <= bookmark {
+			continue
+		}
+		if page.Migrated == MAX_PAGE_SIZE {
+			page.Bookmark = bookmark
+			break
+		}
+		actor := Actor{}
+		if err = json.Unmarshal(response.Value, &actor); err != nil {
+			return shim.Error("ERROR: MIGRATING ACTOR " + response.Key + ". " + err.Error())
+		}
+		if err = updateActor(stub, actor); err != nil {
+			return shim.Error("ERROR: MIGRATING ACTOR " + response.Key + ". " + err.Error())
+		}
+		page.Migrated++
+		bookmark = response.Key
+	}
+	pageBytes, _ := json.Marshal(page)
+	return shim.Success(pageBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+register:  temporarily register funciton. The addresses of the actor are only attached with
+           attachAddress, registering an actor again keeps its attached addresses.
 PublicId            string    // Public identifier of the user
 Role                string    // Role of the actor in the Cache Ecosystem
 ------------------------------------------------------------------------------------------------- */
@@ -98,6 +296,10 @@ Role                string    // Role of the actor in the Cache Ecosystem
 func (t *DataProtocolSmartContract) register(stub shim.ChaincodeStubInterface,
 	args []string) pb.Response {
 
+	if err := checkArgs(args, 1, "register"); err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Retrieving the actor information for registration //
 	actor := Actor{}
 	err := json.Unmarshal([]byte(args[0]), &actor)
@@ -106,6 +308,15 @@ func (t *DataProtocolSmartContract) register(stub shim.ChaincodeStubInterface,
 			err.Error())
 	}
 
+	// Keep the addresses attached to the actor, if any //
+	registered := Actor{PublicId: actor.PublicId}
+	_, err = registered.LoadState(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	actor.PublicAddress = registered.PublicAddress
+	actor.Addresses = registered.Addresses
+
 	// Get role of user //
 	scores := FinancialScores{}
 	switch actor.Role {
@@ -150,39 +361,152 @@ func (t *DataProtocolSmartContract) register(stub shim.ChaincodeStubInterface,
 }
 
 /* -------------------------------------------------------------------------------------------------
-attachAddress: attach new wallet to user
+attachAddress: attach new wallet to user. The first address attached becomes the primary one. The
+               caller should act as the user, or the primary address should co-sign the address
+               (see checkActorConsent).
 PublicId               string    // Public identifier of the user (args[0])
 PublicAddress          string    // Public address of the user (args[1])
+Nonce                  string    // Next nonce of the address in the Coin Balance (args[2])
+Signature              string    // Signature of the operation by the key of the address (args[3])
+PrimaryNonce           string    // Next nonce of the primary address (optional args[4])
+PrimarySignature       string    // Approval of the address by the primary address (optional args[5])
 ------------------------------------------------------------------------------------------------- */
 
 func (t *DataProtocolSmartContract) attachAddress(stub shim.ChaincodeStubInterface,
 	args []string) pb.Response {
 
 	// Load the user from the UserId //
+	if len(args) != 4 && len(args) != 6 {
+		return shim.Error("ERROR: ATTACHADDRESS SHOULD BE CALLED WITH FOUR OR SIX ARGUMENTS.")
+	}
 	actor, err := getActor(stub, args[0])
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	err = checkActorConsent(stub, actor, args[1], "attachAddress", args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	// Register address for the user //
-	invoke_call := []string{"registerAddress"}
-	invoke_call = append(invoke_call, args[1])
-	multiChainCodeArgs := ToChaincodeArgs(invoke_call)
-	response := stub.InvokeChaincode(COIN_BALANCE_CHAINCODE, multiChainCodeArgs,
-		CHANNEL_NAME)
-	if response.Status != shim.OK {
-		return shim.Error("ERROR ATTACHING ADDRESS FOR " + args[0] +
-			" ON BLOCKCHAIN. " + response.Message)
+	_, err = invokeWalletOperation(stub, "registerAddress", args[:4])
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 
 	// Attach Public Address //
+	actor.Addresses = append(actor.Addresses, args[1])
+	if actor.PublicAddress == "" {
+		actor.PublicAddress = args[1]
+	}
+	err = updateActor(stub, actor)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	actorBytes, _ := json.Marshal(actor)
+	return shim.Success(actorBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+detachAddress: detach a wallet from user. The primary address can only be detached when it is the
+               last address of the user. Args: the first four arguments of attachAddress.
+------------------------------------------------------------------------------------------------- */
+
+func (t *DataProtocolSmartContract) detachAddress(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Load the user from the UserId //
+	if len(args) != 4 {
+		return shim.Error("ERROR: DETACHADDRESS SHOULD BE CALLED WITH FOUR ARGUMENTS.")
+	}
+	actor, err := getActor(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !containsAddress(actor.Addresses, args[1]) {
+		return shim.Error("ERROR: ADDRESS " + args[1] + " IS NOT ATTACHED TO " + args[0])
+	}
+	if actor.PublicAddress == args[1] && len(actor.Addresses) > 1 {
+		return shim.Error("ERROR: ADDRESS " + args[1] + " IS THE PRIMARY ADDRESS OF " +
+			args[0] + ". ANOTHER PRIMARY ADDRESS SHOULD BE SET FIRST.")
+	}
+
+	// Unregister address of the user //
+	_, err = invokeWalletOperation(stub, "unregisterAddress", args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Detach Public Address //
+	addresses := []string{}
+	for _, address := range actor.Addresses {
+		if address != args[1] {
+			addresses = append(addresses, address)
+		}
+	}
+	actor.Addresses = addresses
+	if actor.PublicAddress == args[1] {
+		actor.PublicAddress = ""
+	}
+	owner := AddressOwner{Address: args[1]}
+	compositeKey, err := owner.ToCompositeKey(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.DelState(compositeKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = updateActor(stub, actor)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	actorBytes, _ := json.Marshal(actor)
+	return shim.Success(actorBytes)
+}
+
+/* -------------------------------------------------------------------------------------------------
+setPrimaryAddress: set an attached wallet as the primary address of the user. The caller should act
+                   as the user, or the current primary address should co-sign the new one.
+                   Args: same as attachAddress.
+------------------------------------------------------------------------------------------------- */
+
+func (t *DataProtocolSmartContract) setPrimaryAddress(stub shim.ChaincodeStubInterface,
+	args []string) pb.Response {
+
+	// Load the user from the UserId //
+	if len(args) != 4 && len(args) != 6 {
+		return shim.Error("ERROR: SETPRIMARYADDRESS SHOULD BE CALLED WITH FOUR OR SIX " +
+			"ARGUMENTS.")
+	}
+	actor, err := getActor(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !containsAddress(actor.Addresses, args[1]) {
+		return shim.Error("ERROR: ADDRESS " + args[1] + " IS NOT ATTACHED TO " + args[0])
+	}
+	err = checkActorConsent(stub, actor, args[1], "setPrimaryAddress", args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Confirm address with the signature of its key //
+	_, err = invokeWalletOperation(stub, "confirmPrimaryAddress", args[:4])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	actor.PublicAddress = args[1]
 	err = updateActor(stub, actor)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	return shim.Success(nil)
+	actorBytes, _ := json.Marshal(actor)
+	return shim.Success(actorBytes)
 }
 
 /* --------------------------------------------------------------------------------------------------
@@ -0,0 +1,138 @@
+///////////////////////////////////////////////////////////////////
+// File containing the access control of the Data Protocol Smart
+// Contract. Every function is checked against an access rule stored
+// on the ledger, which is seeded at Init and managed by the admins.
+///////////////////////////////////////////////////////////////////
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+/* -------------------------------------------------------------------------------------------------
+ Default access rules seeded at Init. Functions without roles can be called by any identity of the
+ network, they are protected by the signatures of the addresses checked by the Coin Balance or are
+ read only.
+------------------------------------------------------------------------------------------------- */
+
+var adminFunctions = []string{
+	"register", "migrateDocTypes", "setAccessRule", "removeAccessRule",
+}
+
+var publicFunctions = []string{
+	"attachAddress", "detachAddress", "setPrimaryAddress", "getUserByAddress", "getUser",
+	"getRoleList", "getRoleListPage", "getAccessRule", "getAccessRules",
+}
+
+// Functions whose rule should always allow the admins, so that the table cannot lock them out //
+var aclFunctions = []string{"setAccessRule", "removeAccessRule"}
+
+// Functions rewriting the stored states, whose rule should only ever allow the admins //
+var adminOnlyFunctions = []string{"migrateDocTypes"}
+
+func defaultAccessRules() []AccessRule {
+	rules := []AccessRule{}
+	for _, function := range adminFunctions {
+		rules = append(rules, AccessRule{Function: function, Roles: []string{ADMIN_ROLE}})
+	}
+	for _, function := range publicFunctions {
+		rules = append(rules, AccessRule{Function: function})
+	}
+	return rules
+}
+
+/* -------------------------------------------------------------------------------------------------
+ seedAccessRules: this function stores the default rule of every function that has no rule yet, so
+                  the rules changed by the admins are kept on upgrades
+------------------------------------------------------------------------------------------------- */
+
+func seedAccessRules(stub shim.ChaincodeStubInterface) error {
+	for _, rule := range defaultAccessRules() {
+		stored := AccessRule{Function: rule.Function}
+		isLoaded, err := stored.LoadState(stub)
+		if err != nil {
+			return err
+		}
+		if isLoaded {
+			continue
+		}
+		if err = rule.SaveState(stub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+ checkAccess: this function checks the caller against the access rule of a function. The caller
+              should have one of the roles and belong to one of the MSPs of the rule, when they are
+              set, and satisfy every attribute predicate of the rule.
+------------------------------------------------------------------------------------------------- */
+
+func checkAccess(stub shim.ChaincodeStubInterface, function string) error {
+
+	rule := AccessRule{Function: function}
+	isLoaded, err := rule.LoadState(stub)
+	if err != nil {
+		return errors.New("ERROR: GETTING THE ACCESS RULE OF " + function + ". " + err.Error())
+	}
+	if !isLoaded {
+		return errors.New("PERMISSION DENIED TO CALL " + function +
+			". THE FUNCTION HAS NO ACCESS RULE.")
+	}
+
+	// Check roles and MSP of the caller //
+	if len(rule.Roles) > 0 {
+		if err = checkAnyPermission(stub, rule.Roles, function); err != nil {
+			return err
+		}
+	}
+	if len(rule.MSPs) > 0 {
+		mspId, err := cid.GetMSPID(stub)
+		if err != nil || !stringInSlice(mspId, rule.MSPs) {
+			return errors.New("PERMISSION DENIED TO CALL " + function)
+		}
+	}
+
+	// Check attribute predicates of the caller //
+	for name, value := range rule.Attributes {
+		attribute, found, err := cid.GetAttributeValue(stub, name)
+		if err != nil || !found || (value != ANY_ATTRIBUTE_VALUE && attribute != value) {
+			return errors.New("PERMISSION DENIED TO CALL " + function)
+		}
+	}
+	return nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+ getAccessRules: this function returns all the access rules stored on the ledger
+------------------------------------------------------------------------------------------------- */
+
+func getAccessRules(stub shim.ChaincodeStubInterface) ([]AccessRule, error) {
+	it, err := stub.GetStateByPartialCompositeKey(IndexAccessRules, []string{})
+	if err != nil {
+		return nil, errors.New("ERROR: unable to get an iterator over the access rules")
+	}
+	defer it.Close()
+	rules := []AccessRule{}
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return nil, errors.New(message)
+		}
+		var rule AccessRule
+		if err = json.Unmarshal(response.Value, &rule); err != nil {
+			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
+			return nil, errors.New(message)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
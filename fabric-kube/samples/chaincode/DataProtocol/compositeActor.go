@@ -9,6 +9,7 @@ import (
 )
 
 func (obj *Actor) ToLedgerValue() ([]byte, error) {
+	obj.DocType = DOC_TYPE_ACTOR
 	return json.Marshal(obj)
 }
 
@@ -8,6 +8,11 @@ package main
 -------------------------------------------------------- */
 
 const IndexNetwork = "NETWORK"
+const IndexAddresses = "ADDRESSES"
+const IndexAccessRules = "ACCESS_RULES"
+
+// Document type of the actors queried with CouchDB selectors //
+const DOC_TYPE_ACTOR = "actor"
 
 const IndexEncryption = "ENCRYPTION"
 const IndexDecryption = "DECRYPTION"
@@ -20,6 +25,17 @@ const GUARANTOR_ROLE = "GUARANTOR"
 const COURTMEMBER_ROLE = "COURT_MEMBER"
 const EXCHANGE_ROLE = "EXCHANGE"
 
+// Value of an attribute predicate of an access rule satisfied by any value of the attribute //
+const ANY_ATTRIBUTE_VALUE = "*"
+
+// Attribute of the identity of the caller holding the PublicId of the actor it acts as //
+const ACTOR_ID_ATTRIBUTE = "publicId"
+
+const DEFAULT_PAGE_SIZE = 50
+const MAX_PAGE_SIZE = 200
+const SORT_ASC = "asc"
+const SORT_DESC = "desc"
+
 const COIN_BALANCE_CHAINCODE = "CoinBalance"
 const CHANNEL_NAME = "broadcast"
 
@@ -12,11 +12,43 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 
 	//"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 )
 
+/* -------------------------------------------------------------------------------------------------
+ checkPermissions: check if user has permissions to call a given function
+------------------------------------------------------------------------------------------------- */
+
+func checkPermissions(stub shim.ChaincodeStubInterface, userRole string,
+	functionName string) error {
+
+	if err := cid.AssertAttributeValue(stub, "userRole", userRole); err != nil {
+		return errors.New("PERMISSION DENIED TO CALL " + functionName)
+	}
+	return nil
+
+}
+
+/* -------------------------------------------------------------------------------------------------
+ checkAnyPermission: check if user has one of the roles allowed to call a given function
+------------------------------------------------------------------------------------------------- */
+
+func checkAnyPermission(stub shim.ChaincodeStubInterface, userRoles []string,
+	functionName string) error {
+
+	for _, userRole := range userRoles {
+		if err := checkPermissions(stub, userRole, functionName); err == nil {
+			return nil
+		}
+	}
+	return errors.New("PERMISSION DENIED TO CALL " + functionName)
+
+}
+
 /* -------------------------------------------------------------------------------------------------
 getActor:  this function returns the supply and information of a given actor
 ------------------------------------------------------------------------------------------------- */
@@ -36,6 +68,11 @@ func getActor(stub shim.ChaincodeStubInterface, publicId string) (Actor, error)
 		return actor, errors.New("ERROR: ACTOR " + publicId + " IS NOT REGISTERED " +
 			"ON THE SYSTEM. ")
 	}
+
+	// Actors registered with a single address only have the primary address //
+	if actor.PublicAddress != "" && !containsAddress(actor.Addresses, actor.PublicAddress) {
+		actor.Addresses = append([]string{actor.PublicAddress}, actor.Addresses...)
+	}
 	return actor, nil
 }
 
@@ -61,14 +98,151 @@ func checkActorRegistered(stub shim.ChaincodeStubInterface, publicId string) (bo
 }
 
 /* -------------------------------------------------------------------------------------------------
-updateActor:  this function updates/register a actor on blockchain
+updateActor:  this function updates/register a actor on blockchain. An address attached to another
+              actor is never taken over.
 ------------------------------------------------------------------------------------------------- */
 
 func updateActor(stub shim.ChaincodeStubInterface, actor Actor) error {
 
+	// Keep the primary address of actors registered with a single address //
+	if actor.PublicAddress != "" && !containsAddress(actor.Addresses, actor.PublicAddress) {
+		actor.Addresses = append([]string{actor.PublicAddress}, actor.Addresses...)
+	}
+
+	// Update reverse lookup of the addresses of the actor //
+	for _, address := range actor.Addresses {
+		owner := AddressOwner{Address: address}
+		isLoaded, err := owner.LoadState(stub)
+		if err != nil {
+			return errors.New("ERROR: GETTING THE OWNER OF ADDRESS " + address + ". " +
+				err.Error())
+		}
+		if isLoaded && owner.PublicId == actor.PublicId {
+			continue
+		}
+		if isLoaded {
+			return errors.New("ERROR: ADDRESS " + address + " IS ALREADY ATTACHED TO " +
+				owner.PublicId + ".")
+		}
+		owner.PublicId = actor.PublicId
+		if err = owner.SaveState(stub); err != nil {
+			return err
+		}
+	}
+
 	// Update actor on Blockchain //
-	if err := actor.SaveState(stub); err != nil {
-		return err
+	return actor.SaveState(stub)
+}
+
+/* -------------------------------------------------------------------------------------------------
+getAddressOwner:  this function returns the actor an address is attached to
+------------------------------------------------------------------------------------------------- */
+
+func getAddressOwner(stub shim.ChaincodeStubInterface, address string) (Actor, error) {
+
+	owner := AddressOwner{Address: address}
+	isLoaded, err := owner.LoadState(stub)
+	if err != nil {
+		return Actor{}, errors.New("ERROR: GETTING THE OWNER OF ADDRESS " + address +
+			". " + err.Error())
+	}
+	if !isLoaded {
+		return Actor{}, errors.New("ERROR: ADDRESS " + address + " IS NOT ATTACHED " +
+			"TO ANY ACTOR. ")
+	}
+	return getActor(stub, owner.PublicId)
+}
+
+/* -------------------------------------------------------------------------------------------------
+containsAddress:  this function checks if an address is in a list of addresses
+------------------------------------------------------------------------------------------------- */
+
+func containsAddress(addresses []string, address string) bool {
+	for _, element := range addresses {
+		if element == address {
+			return true
+		}
+	}
+	return false
+}
+
+/* -------------------------------------------------------------------------------------------------
+invokeWalletOperation:  this function forwards a signed operation on a wallet address to the Coin
+                        Balance, which checks the signature of the key of the address.
+------------------------------------------------------------------------------------------------- */
+
+func invokeWalletOperation(stub shim.ChaincodeStubInterface, function string,
+	args []string) (WalletOperation, error) {
+
+	operation := WalletOperation{}
+	if len(args) != 4 {
+		return operation, errors.New("ERROR: " + function + " SHOULD BE CALLED WITH " +
+			"FOUR ARGUMENTS.")
+	}
+	nonce, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return operation, errors.New("ERROR: INVALID NONCE " + args[2])
+	}
+	operation = WalletOperation{
+		PublicId: args[0], Address: args[1], Nonce: nonce, Signature: args[3]}
+
+	invoke_call := []string{function}
+	invoke_call = append(invoke_call, toStringMethod(operation))
+	multiChainCodeArgs := ToChaincodeArgs(invoke_call)
+	response := stub.InvokeChaincode(COIN_BALANCE_CHAINCODE, multiChainCodeArgs,
+		CHANNEL_NAME)
+	if response.Status != shim.OK {
+		return operation, errors.New("ERROR UPDATING ADDRESS " + args[1] + " OF " +
+			args[0] + " ON BLOCKCHAIN. " + response.Message)
+	}
+	return operation, nil
+}
+
+/* -------------------------------------------------------------------------------------------------
+checkActorConsent:  this function checks that the actor consents to an address being attached to it
+                    or set as its primary address. The caller should act as the actor, or the
+                    current primary address of the actor should co-sign the address with the nonce
+                    and the signature of the optional args[4] and args[5]. The first address of an
+                    actor without primary address can also be attached by an admin.
+------------------------------------------------------------------------------------------------- */
+
+func checkActorConsent(stub shim.ChaincodeStubInterface, actor Actor, address string,
+	function string, args []string) error {
+
+	// The caller acts as the actor //
+	publicId, found, err := cid.GetAttributeValue(stub, ACTOR_ID_ATTRIBUTE)
+	if err == nil && found && publicId == actor.PublicId {
+		return nil
+	}
+	if actor.PublicAddress == "" {
+		if err = checkPermissions(stub, ADMIN_ROLE, function); err != nil {
+			return errors.New("ERROR: THE FIRST ADDRESS OF " + actor.PublicId + " SHOULD BE " +
+				"ATTACHED BY THE ACTOR OR AN ADMIN.")
+		}
+		return nil
+	}
+
+	// The primary address of the actor co-signs the address //
+	if len(args) != 6 {
+		return errors.New("ERROR: " + function + " SHOULD BE CALLED BY " + actor.PublicId +
+			" OR CO-SIGNED BY ITS PRIMARY ADDRESS " + actor.PublicAddress + ".")
+	}
+	nonce, err := strconv.ParseUint(args[4], 10, 64)
+	if err != nil {
+		return errors.New("ERROR: INVALID NONCE " + args[4])
+	}
+	approval := WalletOperation{
+		PublicId: actor.PublicId, Address: actor.PublicAddress, Approved: address,
+		Nonce: nonce, Signature: args[5]}
+
+	invoke_call := []string{"approveAddress"}
+	invoke_call = append(invoke_call, toStringMethod(approval))
+	multiChainCodeArgs := ToChaincodeArgs(invoke_call)
+	response := stub.InvokeChaincode(COIN_BALANCE_CHAINCODE, multiChainCodeArgs,
+		CHANNEL_NAME)
+	if response.Status != shim.OK {
+		return errors.New("ERROR: THE PRIMARY ADDRESS OF " + actor.PublicId + " DID NOT " +
+			"APPROVE " + address + ". " + response.Message)
 	}
 	return nil
 }
@@ -78,7 +252,8 @@ getRoleList: returns the list of actors with its system info of a given type
 ------------------------------------------------------------------------------------------------- */
 
 func getRoleList(stub shim.ChaincodeStubInterface, role string) ([]string, error) {
-	queryString := fmt.Sprintf(`{"selector":{"Role":"%s"}}`, role)
+	queryString := fmt.Sprintf(`{"selector":{"docType":"%s","Role":"%s"}}`,
+		DOC_TYPE_ACTOR, role)
 	it, err := stub.GetQueryResult(queryString)
 	if err != nil {
 		return nil, errors.New("ERROR: unable to get an iterator over the balances")
@@ -101,5 +276,73 @@ func getRoleList(stub shim.ChaincodeStubInterface, role string) ([]string, error
 	return actorList, nil
 }
 
+/* -------------------------------------------------------------------------------------------------
+getRoleListPage: returns a page of the actors of a given type, sorted by PublicId if requested
+------------------------------------------------------------------------------------------------- */
+
+func getRoleListPage(stub shim.ChaincodeStubInterface, role string,
+	pageQuery PageQuery) (QueryPage, error) {
+
+	page := QueryPage{}
+	selector := map[string]interface{}{"docType": DOC_TYPE_ACTOR, "Role": role}
+	query := map[string]interface{}{"selector": selector}
+
+	// Sort by the fields of the docType, Role and PublicId index //
+	if pageQuery.SortBy != "" {
+		if pageQuery.SortBy != "PublicId" {
+			return page, errors.New("ERROR: SORTING BY " + pageQuery.SortBy +
+				" IS NOT SUPPORTED.")
+		}
+		if pageQuery.SortOrder == "" {
+			pageQuery.SortOrder = SORT_ASC
+		}
+		if pageQuery.SortOrder != SORT_ASC && pageQuery.SortOrder != SORT_DESC {
+			return page, errors.New("ERROR: SORT ORDER SHOULD BE " + SORT_ASC +
+				" OR " + SORT_DESC + ".")
+		}
+		selector["PublicId"] = map[string]interface{}{"$gt": nil}
+		query["sort"] = []map[string]string{{"docType": pageQuery.SortOrder},
+			{"Role": pageQuery.SortOrder}, {"PublicId": pageQuery.SortOrder}}
+	}
+	queryBytes, err := json.Marshal(query)
+	if err != nil {
+		return page, err
+	}
+
+	// Limit size of the page //
+	if pageQuery.PageSize <= 0 {
+		pageQuery.PageSize = DEFAULT_PAGE_SIZE
+	}
+	if pageQuery.PageSize > MAX_PAGE_SIZE {
+		pageQuery.PageSize = MAX_PAGE_SIZE
+	}
+
+	it, metadata, err := stub.GetQueryResultWithPagination(string(queryBytes),
+		pageQuery.PageSize, pageQuery.Bookmark)
+	if err != nil {
+		return page, errors.New("ERROR: unable to get an iterator over the actors. " +
+			err.Error())
+	}
+	defer it.Close()
+	actorList := []string{}
+	for it.HasNext() {
+		response, error := it.Next()
+		if error != nil {
+			message := fmt.Sprintf("unable to get the next element: %s", error.Error())
+			return page, errors.New(message)
+		}
+		var actor Actor
+		if err = json.Unmarshal(response.Value, &actor); err != nil {
+			message := fmt.Sprintf("ERROR: unable to parse the response: %s", err.Error())
+			return page, errors.New(message)
+		}
+		actorList = append(actorList, actor.PublicId)
+	}
+	page.Records = actorList
+	page.FetchedRecordsCount = metadata.FetchedRecordsCount
+	page.Bookmark = metadata.Bookmark
+	return page, nil
+}
+
 /* -------------------------------------------------------------------------------------------------
 ------------------------------------------------------------------------------------------------- */
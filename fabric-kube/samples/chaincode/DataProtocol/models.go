@@ -20,12 +20,62 @@ type DataProtocolSmartContract struct{}
 // 	UpdateUsers             map[string]Actor            `json:"UpdateUsers"`
 // }
 
-// Definition of an actor in the Cache Ecosystem //
+// Definition of an actor in the Cache Ecosystem. PublicAddress is the primary address //
+// among the Addresses attached to the actor                                          //
 type Actor struct {
 	PublicId      string          `json:"PublicId"`
 	PublicAddress string          `json:"PublicAddress"`
+	Addresses     []string        `json:"Addresses"`
 	Role          string          `json:"Role"`
 	Privacy       map[string]bool `json:"Privacy"`
+	DocType       string          `json:"docType"`
+}
+
+// Definition of the reverse lookup from an address to its actor //
+type AddressOwner struct {
+	Address  string `json:"Address"`
+	PublicId string `json:"PublicId"`
+}
+
+// Definition of an operation on a wallet address signed by the key of the address. Approved //
+// is the address attached or set as primary with the approval of the primary Address     //
+type WalletOperation struct {
+	PublicId  string `json:"PublicId"`
+	Address   string `json:"Address"`
+	Approved  string `json:"Approved,omitempty"`
+	Nonce     uint64 `json:"Nonce"`
+	Signature string `json:"Signature"`
+}
+
+// Definition of the access rule of a function. The caller should have one of the Roles and //
+// belong to one of the MSPs when they are set, and satisfy every predicate of Attributes   //
+type AccessRule struct {
+	Function   string            `json:"Function"`
+	Roles      []string          `json:"Roles"`
+	MSPs       []string          `json:"MSPs"`
+	Attributes map[string]string `json:"Attributes"`
+}
+
+// Definition of the pagination and sorting of a rich query //
+type PageQuery struct {
+	PageSize  int32  `json:"PageSize"`
+	Bookmark  string `json:"Bookmark"`
+	SortBy    string `json:"SortBy"`
+	SortOrder string `json:"SortOrder"`
+}
+
+// Definition of a batch of a state migration. Bookmark is the last migrated key //
+type MigrationPage struct {
+	DocType  string `json:"docType"`
+	Migrated int    `json:"Migrated"`
+	Bookmark string `json:"Bookmark"`
+}
+
+// Definition of a page of results of a rich query. Bookmark is used to get the next page //
+type QueryPage struct {
+	Records             interface{} `json:"Records"`
+	FetchedRecordsCount int32       `json:"FetchedRecordsCount"`
+	Bookmark            string      `json:"Bookmark"`
 }
 
 // // Definition of the encryption object with DIDs //
@@ -6,6 +6,7 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"strings"
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/protos/msp"
@@ -62,3 +63,25 @@ func toStringMethod(object interface{}) string {
 	objectBytes, _ := json.Marshal(object)
 	return string(objectBytes)
 }
+
+func stringInSlice(a string, list []string) bool {
+	for _, b := range list {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+/* -------------------------------------------------------------------------------------------------
+ checkArgs: this function checks that a function is called with the arguments it reads, so that a
+            missing argument is rejected instead of panicking
+------------------------------------------------------------------------------------------------- */
+
+func checkArgs(args []string, count int, function string) error {
+	if len(args) < count {
+		return fmt.Errorf("ERROR: %s FUNCTION SHOULD BE CALLED WITH AT LEAST %d ARGUMENTS.",
+			strings.ToUpper(function), count)
+	}
+	return nil
+}